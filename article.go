@@ -0,0 +1,136 @@
+package nntp
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// headerOrder is the order WriteTo writes the common headers in, before
+// any others.
+var headerOrder = []string{
+	"Path", "From", "Newsgroups", "Subject", "Date", "Message-Id",
+	"References", "Followup-To", "Reply-To", "Sender", "Organization",
+	"Approved", "Supersedes", "Expires", "Distribution", "Keywords",
+	"Summary", "Lines", "Xref", "Mime-Version", "Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+// maxHeaderLine is the line length WriteTo folds headers at, as
+// recommended by RFC 5322, section 2.1.1.
+const maxHeaderLine = 78
+
+// WriteTo writes the article in RFC 5322 format with CRLF line endings,
+// as stored in .eml files: the headers, the common ones first and the
+// others sorted, then an empty line and the body. Unlike the data sent
+// for POST, the body isn't dot-stuffed.
+//
+// Long header lines are folded. The body is consumed.
+func (a *Article) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(s string) error {
+		m, err := bw.WriteString(s)
+		n += int64(m)
+		return err
+	}
+
+	names := make([]string, 0, len(a.Header))
+	for name := range a.Header {
+		names = append(names, name)
+	}
+	rank := func(name string) int {
+		for i, h := range headerOrder {
+			if h == name {
+				return i
+			}
+		}
+		return len(headerOrder)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := rank(names[i]), rank(names[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		for _, value := range a.Header[name] {
+			if err := write(foldHeader(name, value)); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := write("\r\n"); err != nil {
+		return n, err
+	}
+
+	if a.Body != nil {
+		br := bufio.NewReader(a.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+				if werr := write(line + "\r\n"); werr != nil {
+					return n, werr
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, bw.Flush()
+}
+
+// foldHeader returns a header line, CRLF included, folded before
+// whitespace to keep lines within maxHeaderLine where possible, so that
+// unfolding restores the value. Values that are already folded keep
+// their line breaks.
+func foldHeader(name, value string) string {
+	if strings.ContainsAny(value, "\r\n") {
+		value = strings.ReplaceAll(value, "\r\n", "\n")
+		return name + ": " + strings.ReplaceAll(value, "\n", "\r\n") + "\r\n"
+	}
+	var b strings.Builder
+	line := name + ": " + value
+	// Never fold right after the colon.
+	start := len(name) + 2
+	for len(line) > maxHeaderLine {
+		i := -1
+		for j := min(maxHeaderLine, len(line)-1); j > start && i < 0; j-- {
+			if foldable(line, start, j) {
+				i = j
+			}
+		}
+		for j := max(start, maxHeaderLine); j < len(line) && i < 0; j++ {
+			// An over-long word; break after it instead.
+			if foldable(line, start, j) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n")
+		line = line[i:]
+		start = 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// foldable reports whether a header line may be folded at whitespace at
+// i, which mustn't leave either the line (from start) or the rest of it
+// with whitespace only.
+func foldable(line string, start, i int) bool {
+	return (line[i] == ' ' || line[i] == '\t') &&
+		strings.TrimLeft(line[start:i], " \t") != "" &&
+		strings.TrimLeft(line[i:], " \t") != ""
+}
@@ -0,0 +1,72 @@
+package nntp
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestArticleWriteTo(t *testing.T) {
+	subject := "A subject long enough to need folding, as it goes on and on " +
+		"well past the seventy-eight characters RFC 5322 recommends"
+	a := &Article{
+		Header: textproto.MIMEHeader{
+			"X-Extra":    {"extra"},
+			"Subject":    {subject},
+			"From":       {"fred@example.com"},
+			"Message-Id": {"<a@example.com>"},
+			"Newsgroups": {"misc.test"},
+		},
+		Body: strings.NewReader("line one\nline two\r\n.dot\n"),
+	}
+	var buf bytes.Buffer
+	n, err := a.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("Wrote %d of %d bytes (%v)", n, buf.Len(), err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "From: fred@example.com\r\nNewsgroups: misc.test\r\nSubject: ") {
+		t.Errorf("Unexpected header order:\n%s", out)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxHeaderLine || strings.Contains(line, "\n") {
+			t.Errorf("Bad line %q", line)
+		}
+	}
+
+	m, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if got := m.Header.Get("Subject"); got != subject {
+		t.Errorf("Got subject %q, wanted %q", got, subject)
+	}
+	if got := m.Header.Get("X-Extra"); got != "extra" {
+		t.Errorf("Got X-Extra %q", got)
+	}
+	body, _ := io.ReadAll(m.Body)
+	if string(body) != "line one\r\nline two\r\n.dot\r\n" {
+		t.Errorf("Got body %q", body)
+	}
+}
+
+func TestFoldHeader(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct{ name, value, want string }{
+		{"Subject", "short", "Subject: short\r\n"},
+		{"References", long + " <b@example.com>", "References: " + long + "\r\n <b@example.com>\r\n"},
+		{"Subject", "pre\r\n folded", "Subject: pre\r\n folded\r\n"},
+		{"Subject", long + " x" + strings.Repeat(" ", 10), "Subject: " + long + "\r\n x" + strings.Repeat(" ", 10) + "\r\n"},
+		// Folding would leave a line of whitespace.
+		{"Subject", strings.Repeat("y", 60) + strings.Repeat(" ", 30), "Subject: " + strings.Repeat("y", 60) + strings.Repeat(" ", 30) + "\r\n"},
+		{"Subject", "a" + strings.Repeat(" ", 100) + "b", "Subject: a" + strings.Repeat(" ", 68) + "\r\n" + strings.Repeat(" ", 32) + "b\r\n"},
+	}
+	for _, test := range tests {
+		if got := foldHeader(test.name, test.value); got != test.want {
+			t.Errorf("Got %q, wanted %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// decodeArticle passes an article through, converting its body to UTF-8
+// if it's text in another charset. Bodies with a content transfer
+// encoding other than 7bit, 8bit or binary are left alone, as are
+// unknown charsets.
+func decodeArticle(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	var head bytes.Buffer
+	for {
+		line, err := br.ReadString('\n')
+		head.WriteString(line)
+		if err == io.EOF {
+			// No body.
+			return &head, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == "\n" || line == "\r\n" {
+			break
+		}
+	}
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(head.Bytes()))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		// Leave malformed headers to the caller.
+		return io.MultiReader(&head, br), nil
+	}
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "", "7bit", "8bit", "binary":
+	default:
+		return io.MultiReader(&head, br), nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "text/") {
+		return io.MultiReader(&head, br), nil
+	}
+	enc, err := htmlindex.Get(params["charset"])
+	if err != nil {
+		return io.MultiReader(&head, br), nil
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return io.MultiReader(&head, br), nil
+	}
+	return io.MultiReader(&head, transform.NewReader(br, enc.NewDecoder())), nil
+}
@@ -0,0 +1,41 @@
+package nntpclient
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	const latin1 = "220 3 <a@example.com>\r\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\r\n\r\ncaf\xe9\r\n.\r\n"
+	c := newTestClient(t,
+		exchange{"ARTICLE 3", latin1},
+		exchange{"ARTICLE 3", latin1},
+		exchange{"ARTICLE 4", "220 4 <b@example.com>\r\n" +
+			"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\nY2Fm6Q==\r\n.\r\n"},
+	)
+	read := func(specifier string) string {
+		t.Helper()
+		_, _, r, err := c.Article(specifier)
+		if err != nil {
+			t.Fatalf("Error getting article: %v", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Error reading article: %v", err)
+		}
+		return string(b)
+	}
+	if got := read("3"); !strings.HasSuffix(got, "\n\ncaf\xe9\n") {
+		t.Fatalf("Body decoded without DecodeCharset: %q", got)
+	}
+	c.DecodeCharset = true
+	if got := read("3"); got != "Content-Type: text/plain; charset=ISO-8859-1\n\ncafé\n" {
+		t.Fatalf("Got %q", got)
+	}
+	if got := read("4"); !strings.HasSuffix(got, "\n\nY2Fm6Q==\n") {
+		t.Fatalf("Encoded body changed: %q", got)
+	}
+}
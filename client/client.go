@@ -28,6 +28,10 @@
 package nntpclient
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -35,110 +39,427 @@ import (
 	"log/slog"
 	"net"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kothawoc/go-nntp"
 )
 
 // Client is an NNTP client.
 type Client struct {
+	// mu serializes exchanges with the server, so methods may be called
+	// from several goroutines (e.g. Ping by a connection pool).
+	mu           sync.Mutex
 	conn         *textproto.Conn
 	netconn      net.Conn
 	tls          bool
 	Banner       string
 	capabilities []string
+	// MaxResponseBytes limits the total size of a multi-line response
+	// (zero means no limit).
+	MaxResponseBytes int
+	// MaxResponseLines limits the number of lines in a multi-line
+	// response (zero means no limit).
+	MaxResponseLines int
+	// MaxPostSizeCapability is the capability label MaxPostSize looks
+	// for (DefaultMaxPostSizeCapability if empty).
+	MaxPostSizeCapability string
+	// Set when a data block was cut short, leaving the connection in
+	// an unknown state.
+	broken bool
+	// Set once the connection is closed. Close sets it without mu,
+	// which may be held by a call waiting for the server.
+	closed atomic.Bool
+	// Set once XFEATURE COMPRESS GZIP is enabled.
+	xfeatureGzip bool
+	// Set once COMPRESS DEFLATE is enabled.
+	compressed bool
+	// Logger receives the client's log messages (slog.Default() if
+	// nil).
+	Logger *slog.Logger
+	// DecodeCharset makes Article convert the body of text articles to
+	// UTF-8, according to the charset parameter of their Content-Type
+	// header. The headers are passed through unchanged. Head and Body
+	// are not affected.
+	DecodeCharset bool
+	// Set by LoadOverviewFmt, cleared when capabilities are retrieved.
+	overviewFmt *nntp.OverviewFmt
+	// PostTimeout limits each phase of Post: waiting for the 340
+	// prompt, writing the article, and waiting for the final response
+	// (zero means no limit). It only works on net.Conn connections.
+	PostTimeout time.Duration
+	// PostingAllowed reports whether the server allows posting, as
+	// said by its banner (200 or 201) or the last MODE READER, and is
+	// set again by successful authentication. Post fails with
+	// ErrPostingNotAllowed without it.
+	PostingAllowed bool
+	deadlines      deadlines
+	// The connection as made, which Close closes (guarded by
+	// deadlines.mu, like netconn).
+	raw io.Closer
+	// ServerName is the host name StartTLS verifies the server's
+	// certificate against if the config doesn't set one. New sets it
+	// from the address it connects to.
+	ServerName string
+	// Retry, if set, makes some calls reconnect and try again after
+	// transient failures; see RetryPolicy.
+	Retry *RetryPolicy
+	// RememberCredentials makes Authenticate and AuthSASL keep the
+	// credentials in memory, so that Reconnect can authenticate again.
+	RememberCredentials bool
+	// The session state restored by Reconnect.
+	network, addr  string
+	implicitTLS    *tls.Config
+	startTLSConfig *tls.Config
+	creds          *credentials
+	currentGroup   *nntp.Group
+}
+
+// logger returns the logger for the client's log messages.
+func (c *Client) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// ErrConnectionBroken is returned for any command issued after a
+// response data block was cut short. The client has to be reconnected.
+var ErrConnectionBroken = errors.New("connection broken by a truncated response")
+
+// ErrClientClosed is returned for any command issued after Quit or
+// Close.
+var ErrClientClosed = errors.New("client closed")
+
+// quitTimeout bounds the wait for the response to QUIT.
+var quitTimeout = 10 * time.Second
+
+// ErrNoSuchArticle is returned by Stat when the server doesn't have the
+// article (a 423 or 430 response). The server's response is wrapped as
+// well, as an nntp.Error.
+var ErrNoSuchArticle = errors.New("no such article")
+
+// ErrNoNextArticle is returned by Next at the end of the group (a 421
+// response), and ErrNoPrevArticle by Last at its start (422). As with
+// ErrNoSuchArticle, the server's response is wrapped as well.
+var (
+	ErrNoNextArticle = errors.New("no next article in this group")
+	ErrNoPrevArticle = errors.New("no previous article in this group")
+)
+
+// DefaultMaxPostSizeCapability is the capability label MaxPostSize looks
+// for by default.
+const DefaultMaxPostSizeCapability = "MAXARTSIZE"
+
+// ResponseTooLargeError is returned when a multi-line response exceeds
+// the client's MaxResponseBytes or MaxResponseLines.
+//
+// The rest of the response is read and discarded, so the connection
+// remains usable.
+type ResponseTooLargeError struct {
+	MaxBytes int
+	MaxLines int
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response too large (limits: %d bytes, %d lines)",
+		e.MaxBytes, e.MaxLines)
 }
 
 // New connects a client to an NNTP server.
-func New(net, addr string) (*Client, error) {
-	conn, err := textproto.Dial(net, addr)
+func New(network, addr string) (*Client, error) {
+	return NewTimeout(network, addr, 0)
+}
+
+// NewTimeout connects a client to an NNTP server, giving up if
+// connecting or then receiving the server's banner takes longer than
+// timeout (zero means no limit).
+func NewTimeout(network, addr string, timeout time.Duration) (*Client, error) {
+	netconn, err := net.DialTimeout(network, addr, timeout)
 	if err != nil {
 		return nil, err
 	}
-
-	_, msg, err := conn.ReadCodeLine(200)
+	if timeout > 0 {
+		netconn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	c, err := NewConn(netconn)
 	if err != nil {
+		netconn.Close()
 		return nil, err
 	}
+	if timeout > 0 {
+		netconn.SetReadDeadline(time.Time{})
+	}
+	c.ServerName = hostname(addr)
+	c.network, c.addr = network, addr
+	return c, nil
+}
 
-	return &Client{
-		conn:   conn,
-		Banner: msg,
-	}, nil
+// hostname returns the host part of an address, which may lack a port.
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// NewTLS connects a client to an NNTP server over TLS from the start
+// (NNTPS, usually on port 563), rather than with StartTLS.
+func NewTLS(network, addr string, config *tls.Config) (*Client, error) {
+	netconn, err := tls.Dial(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewConn(netconn)
+	if err != nil {
+		netconn.Close()
+		return nil, err
+	}
+	c.tls = true
+	c.network, c.addr = network, addr
+	c.implicitTLS = config
+	return c, nil
 }
 
 // New connects a client to an NNTP server.
 func NewConn(establishedConn io.ReadWriteCloser) (*Client, error) {
 	conn := textproto.NewConn(establishedConn)
 
-	_, msg, err := conn.ReadCodeLine(200)
+	code, msg, err := readBanner(conn)
 	if err != nil {
 		return nil, err
 	}
 
+	netconn, _ := establishedConn.(net.Conn)
 	return &Client{
-		conn:   conn,
-		Banner: msg,
+		conn:           conn,
+		netconn:        netconn,
+		raw:            establishedConn,
+		Banner:         msg,
+		PostingAllowed: code == 200,
 	}, nil
 }
 
-// Authenticate against an NNTP server using authinfo user/pass
-func (c *Client) Authenticate(user, pass string) (msg string, err error) {
-	err = c.conn.PrintfLine("authinfo user %s", user)
-	if err != nil {
-		return
+// readBanner reads the server's greeting, which says whether posting is
+// allowed (200) or not (201).
+func readBanner(conn *textproto.Conn) (int, string, error) {
+	code, msg, err := conn.ReadCodeLine(20)
+	err = responseError(err)
+	if err == nil && code != 200 && code != 201 {
+		err = nntp.Error{Code: code, Msg: msg}
 	}
-	_, _, err = c.conn.ReadCodeLine(381)
-	if err != nil {
-		return
+	return code, msg, err
+}
+
+// Quit ends the session with QUIT and closes the connection, which is
+// closed even if the server doesn't answer (within 10 seconds, for
+// net.Conn connections). If another call is using the connection, e.g.
+// waiting for the server or holding an unread Article reader, the
+// session can't be ended cleanly and Quit just closes it, like Close.
+// Calling it again, or after Close, does nothing.
+func (c *Client) Quit() error {
+	if !c.mu.TryLock() {
+		return c.Close()
+	}
+	defer c.mu.Unlock()
+	if c.closed.Load() {
+		return nil
+	}
+	if c.netconn != nil {
+		c.netconn.SetDeadline(time.Now().Add(quitTimeout))
+	}
+	_, _, err := c.command("QUIT", 205)
+	if !c.closed.CompareAndSwap(false, true) {
+		// Closed meanwhile by Close.
+		return err
 	}
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close closes the connection without ending the session with QUIT.
+// It doesn't wait for other calls, which fail once the connection is
+// closed. Calling it again, or after Quit, does nothing.
+func (c *Client) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	c.deadlines.mu.Lock()
+	raw := c.raw
+	c.deadlines.mu.Unlock()
+	return raw.Close()
+}
 
-	err = c.conn.PrintfLine("authinfo pass %s", pass)
+// ErrPostingNotAllowed is returned by Post when the server said posting
+// isn't allowed; see PostingAllowed.
+var ErrPostingNotAllowed = errors.New("posting not allowed")
+
+// ModeReader switches a mode-switching server to reader mode with MODE
+// READER, and reports whether posting is allowed (PostingPermitted) or
+// not (PostingNotPermitted). Capabilities are retrieved again, since
+// they change with the mode, and PostingAllowed is updated.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-5.3
+func (c *Client) ModeReader() (nntp.PostingStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.send("MODE READER"); err != nil {
+		return nntp.Unknown, err
+	}
+	code, msg, err := c.readCodeLine(20)
 	if err != nil {
-		return
+		return nntp.Unknown, err
 	}
-	_, msg, err = c.conn.ReadCodeLine(281)
-	return
+	status := nntp.PostingPermitted
+	switch code {
+	case 200:
+	case 201:
+		status = nntp.PostingNotPermitted
+	default:
+		return nntp.Unknown, nntp.Error{Code: code, Msg: msg}
+	}
+	c.PostingAllowed = status == nntp.PostingPermitted
+	c.overviewFmt = nil
+	if _, err := c.fetchCapabilities(); err != nil {
+		if _, ok := err.(nntp.Error); !ok {
+			return status, err
+		}
+		// Left to be retrieved when needed.
+		c.capabilities = nil
+	}
+	return status, nil
 }
 
-func parsePosting(p string) nntp.PostingStatus {
-	switch p {
-	case "y":
-		return nntp.PostingPermitted
-	case "m":
-		return nntp.PostingModerated
+// Slave tells the server, with the historic SLAVE command, that the
+// client is a slave server serving other users, which some servers
+// take into account.
+//
+// See https://datatracker.ietf.org/doc/html/rfc977#section-3.12
+func (c *Client) Slave() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, err := c.command("SLAVE", 202)
+	return err
+}
+
+// Authenticate against an NNTP server using authinfo user/pass
+//
+// The password is only sent if the server asks for it (381); servers
+// may grant access on the user name alone. With an empty user name,
+// only AUTHINFO PASS is sent, for servers that only want a password.
+func (c *Client) Authenticate(user, pass string) (string, error) {
+	return c.AuthenticateContext(context.Background(), user, pass)
+}
+
+// AuthenticateContext is like Authenticate, but gives up once ctx is
+// done, leaving the connection broken.
+func (c *Client) AuthenticateContext(ctx context.Context, user, pass string) (msg string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		msg, err = c.authenticate(user, pass)
+		return err
+	})
+	if err == nil {
+		c.remember(credentials{user: user, pass: pass})
+	}
+	return msg, err
+}
+
+func (c *Client) authenticate(user, pass string) (msg string, err error) {
+	if user != "" {
+		err = c.send("authinfo user %s", user)
+		if err != nil {
+			return
+		}
+		var code int
+		code, msg, err = c.readCodeLine(0)
+		if err != nil {
+			return
+		}
+		switch code {
+		case 281:
+			c.PostingAllowed = true
+			return
+		case 381:
+		default:
+			return "", nntp.Error{Code: code, Msg: msg}
+		}
+	}
+
+	err = c.send("authinfo pass %s", pass)
+	if err != nil {
+		return
+	}
+	_, msg, err = c.readCodeLine(281)
+	if err == nil {
+		// Posting may be allowed to authenticated users.
+		c.PostingAllowed = true
 	}
-	return nntp.PostingNotPermitted
+	return
 }
 
 // List groups
 func (c *Client) List(sub string) (rv []nntp.Group, err error) {
+	return c.ListContext(context.Background(), sub)
+}
+
+// ListContext is like List, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) ListContext(ctx context.Context, sub string) (groups []nntp.Group, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		groups, err = c.list(sub)
+		return err
+	})
+	return groups, err
+}
+
+func (c *Client) list(sub string) (rv []nntp.Group, err error) {
 	rv = make([]nntp.Group, 0)
 	if sub != "" {
 		sub = " " + sub
 	}
-	_, _, err = c.Command("LIST"+sub, 215)
+	var msg string
+	_, msg, err = c.command("LIST"+sub, 215)
 	if err != nil {
-		slog.Error("list failed, abandoning, error", "error", err)
+		c.logger().Error("list failed", "error", err)
 		return
 	}
 	var groupLines []string
-	groupLines, err = c.conn.ReadDotLines()
+	groupLines, err = c.readBlock(msg)
 	if err != nil {
-		slog.Error("list failed, abandoning, error", "error", err, "groupLines", groupLines)
+		c.logger().Error("reading list failed", "error", err)
 		return
 	}
-	slog.Debug("abandoming error [%v] [%v]", "error", err, "groupLines", groupLines)
 
-	for _, l := range groupLines {
-		slog.Debug("lines list groups", "lines", l)
-		parts := strings.Split(l, " ")
+	rv = c.parseGroupLines(groupLines)
+	c.logger().Debug("listed groups", "count", len(rv))
+	return
+}
+
+// parseGroupLines parses the lines of LIST ACTIVE and similar responses,
+// skipping the lines it can't make sense of.
+func (c *Client) parseGroupLines(lines []string) []nntp.Group {
+	rv := make([]nntp.Group, 0, len(lines))
+	for _, l := range lines {
+		parts := strings.Fields(l)
 		if len(parts) < 3 {
-			slog.Error("abandoming list groups", "parts", parts)
+			c.logger().Error("skipping malformed group line", "line", l)
 			continue
-		} else {
-			slog.Debug("doing list groups", "parts", parts)
+		}
+		// Some servers leave out the posting status.
+		posting := nntp.PostingNotPermitted
+		if len(parts) > 3 {
+			posting = nntp.ParsePostingStatus(parts[3])
 		}
 		high, errh := strconv.ParseInt(parts[1], 10, 64)
 		low, errl := strconv.ParseInt(parts[2], 10, 64)
@@ -147,26 +468,254 @@ func (c *Client) List(sub string) (rv []nntp.Group, err error) {
 				Name:    parts[0],
 				High:    high,
 				Low:     low,
-				Posting: parsePosting(parts[3]),
+				Posting: posting,
 			})
 		}
 	}
+	return rv
+}
 
-	slog.Debug("sgroup ending list", "rv", rv)
-	return
+// ListCounts retrieves the groups matching wildmat (all groups if empty)
+// with LIST COUNTS, which adds the estimated number of articles, as
+// given by GROUP, to the LIST ACTIVE data. Lines without the five fields
+// are skipped.
+//
+// The server has to advertise COUNTS in its LIST capability;
+// capabilities are retrieved first if necessary.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6048#section-2.2
+func (c *Client) ListCounts(wildmat string) ([]nntp.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capabilities == nil {
+		if _, err := c.fetchCapabilities(); err != nil {
+			return nil, err
+		}
+	}
+	ok, err := c.hasCapabilityArgument("LIST", "COUNTS")
+	if err != nil || !ok {
+		return nil, errors.New("LIST COUNTS not supported by server")
+	}
+	cmd := "LIST COUNTS"
+	if wildmat != "" {
+		cmd += " " + wildmat
+	}
+	lines, err := c.asLines(cmd, 215)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]nntp.Group, 0, len(lines))
+	for _, l := range lines {
+		// name high low count status
+		parts := strings.Fields(l)
+		if len(parts) < 5 {
+			c.logger().Debug("skipping malformed counts line", "line", l)
+			continue
+		}
+		high, errh := strconv.ParseInt(parts[1], 10, 64)
+		low, errl := strconv.ParseInt(parts[2], 10, 64)
+		count, errc := strconv.ParseInt(parts[3], 10, 64)
+		if errh != nil || errl != nil || errc != nil {
+			c.logger().Debug("skipping malformed counts line", "line", l)
+			continue
+		}
+		rv = append(rv, nntp.Group{
+			Name:    parts[0],
+			High:    high,
+			Low:     low,
+			Count:   count,
+			Posting: nntp.ParsePostingStatus(parts[4]),
+		})
+	}
+	return rv, nil
+}
+
+// FormatNNTPDate returns the date ("yyyymmdd") and time ("hhmmss")
+// arguments of NEWGROUPS and NEWNEWS for t, which are sent as GMT.
+//
+// RFC 3977 also allows a two-digit year, but the four-digit form is
+// always used here, since RFC 977 servers guess the century.
+func FormatNNTPDate(t time.Time) (date, timeStr string) {
+	t = t.UTC()
+	return t.Format("20060102"), t.Format("150405")
+}
+
+// NewGroups returns the groups created since the given time.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-7.3
+func (c *Client) NewGroups(since time.Time) ([]nntp.Group, error) {
+	return c.NewGroupsContext(context.Background(), since)
+}
+
+// NewGroupsContext is like NewGroups, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) NewGroupsContext(ctx context.Context, since time.Time) (groups []nntp.Group, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		groups, err = c.newGroups(since)
+		return err
+	})
+	return groups, err
+}
+
+func (c *Client) newGroups(since time.Time) ([]nntp.Group, error) {
+	date, timeStr := FormatNNTPDate(since)
+	lines, err := c.asLines(fmt.Sprintf("NEWGROUPS %s %s GMT", date, timeStr), 231)
+	if err != nil {
+		return nil, err
+	}
+	return c.parseGroupLines(lines), nil
+}
+
+// ListActiveTimes retrieves the creation times and creators of the groups
+// matching wildmat (all groups if empty) with LIST ACTIVE.TIMES, keyed
+// by group name. Malformed lines are skipped.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6048#section-3
+func (c *Client) ListActiveTimes(wildmat string) (map[string]nntp.GroupTime, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd := "LIST ACTIVE.TIMES"
+	if wildmat != "" {
+		cmd += " " + wildmat
+	}
+	lines, err := c.asLines(cmd, 215)
+	if err != nil {
+		return nil, err
+	}
+	times := make(map[string]nntp.GroupTime, len(lines))
+	for _, line := range lines {
+		groups, err := nntp.ParseActiveTimes([]string{line})
+		if err != nil {
+			c.logger().Debug("skipping malformed active.times line", "line", line)
+			continue
+		}
+		times[groups[0].Name] = groups[0]
+	}
+	return times, nil
+}
+
+// GroupsCreatedSince returns the groups created after t, oldest first.
+//
+// Unlike NewGroups, it retrieves LIST ACTIVE.TIMES and compares the
+// creation times itself, which also works with servers that ignore the
+// date given to NEWGROUPS.
+func (c *Client) GroupsCreatedSince(t time.Time) ([]nntp.GroupTime, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines, err := c.asLines("LIST ACTIVE.TIMES", 215)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := nntp.ParseActiveTimes(lines)
+	if err != nil {
+		return nil, err
+	}
+	created := groups[:0]
+	for _, g := range groups {
+		if g.Created.After(t) {
+			created = append(created, g)
+		}
+	}
+	sort.SliceStable(created, func(i, j int) bool {
+		return created[i].Created.Before(created[j].Created)
+	})
+	return created, nil
+}
+
+// NewNews returns the message-ids of the articles posted since the given
+// time to groups matching wildmat (e.g. "comp.*,!comp.os.*"), which is
+// sent as is. No new articles give an empty, non-nil slice.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-7.4
+func (c *Client) NewNews(wildmat string, since time.Time) ([]string, error) {
+	return c.NewNewsContext(context.Background(), wildmat, since)
+}
+
+// NewNewsContext is like NewNews, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) NewNewsContext(ctx context.Context, wildmat string, since time.Time) (ids []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		ids, err = c.newNews(wildmat, since)
+		return err
+	})
+	return ids, err
+}
+
+func (c *Client) newNews(wildmat string, since time.Time) ([]string, error) {
+	date, timeStr := FormatNNTPDate(since)
+	ids, err := c.asLines(fmt.Sprintf("NEWNEWS %s %s %s GMT", wildmat, date, timeStr), 230)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
 }
 
 // Group selects a group.
-func (c *Client) Group(name string) (rv nntp.Group, err error) {
-	var msg string
-	_, msg, err = c.Command("GROUP "+name, 211)
+func (c *Client) Group(name string) (nntp.Group, error) {
+	return c.GroupContext(context.Background(), name)
+}
+
+// GroupContext is like Group, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) GroupContext(ctx context.Context, name string) (g nntp.Group, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
 	if err != nil {
-		return
+		return g, err
+	}
+	defer func() { err = stop(err) }()
+	return retry(ctx, c, func() (nntp.Group, error) {
+		return c.group(name)
+	})
+}
+
+func (c *Client) group(name string) (nntp.Group, error) {
+	_, msg, err := c.command("GROUP "+name, 211)
+	if err != nil {
+		return nntp.Group{}, err
 	}
-	// count first last name
-	parts := strings.Split(msg, " ")
-	if len(parts) != 4 {
-		err = errors.New("Don't know how to parse result: " + msg)
+	g, err := parseGroupStatus(msg, name)
+	if err != nil {
+		return nntp.Group{}, err
+	}
+	c.currentGroup = &g
+	return g, nil
+}
+
+// CurrentGroup returns the group last selected with Group or ListGroup,
+// as reported by the server then, and whether there is one. Groups
+// selected with Command aren't known.
+func (c *Client) CurrentGroup() (nntp.Group, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.currentGroup == nil {
+		return nntp.Group{}, false
+	}
+	return *c.currentGroup, true
+}
+
+// parseGroupStatus parses the 211 status line of GROUP and LISTGROUP.
+func parseGroupStatus(msg, name string) (rv nntp.Group, err error) {
+	// count first last name, possibly padded with extra whitespace
+	parts := strings.Fields(msg)
+	switch {
+	case len(parts) >= 4:
+		// LISTGROUP responses may have text after the name.
+		parts = parts[:4]
+	case len(parts) == 3:
+		// Some servers don't repeat the group name.
+		parts = append(parts, name)
+	default:
+		err = fmt.Errorf("invalid group status %q", msg)
+		return
 	}
 	rv.Count, err = strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
@@ -185,98 +734,723 @@ func (c *Client) Group(name string) (rv nntp.Group, err error) {
 	return
 }
 
-// Article grabs an article
-func (c *Client) Article(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("ARTICLE %s", specifier)
+// ListGroup selects a group and returns the numbers of its articles,
+// either all of them, or those within a range given as for Over.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-6.1.2
+func (c *Client) ListGroup(name string, rng ...int) (nntp.Group, []int64, error) {
+	return c.ListGroupContext(context.Background(), name, rng...)
+}
+
+// ListGroupContext is like ListGroup, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) ListGroupContext(ctx context.Context, name string, rng ...int) (g nntp.Group, nums []int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		g, nums, err = c.listGroup(name, rng...)
+		return err
+	})
+	return g, nums, err
+}
+
+func (c *Client) listGroup(name string, rng ...int) (nntp.Group, []int64, error) {
+	arg, err := rangeArg(rng)
+	if err != nil {
+		return nntp.Group{}, nil, err
+	}
+	cmd := "LISTGROUP " + name
+	if arg != "" {
+		cmd += " " + arg
+	}
+	_, msg, lines, err := c.dataCommand(cmd, 211)
+	if err != nil {
+		return nntp.Group{}, nil, err
+	}
+	g, err := parseGroupStatus(msg, name)
+	if err != nil {
+		return nntp.Group{}, nil, err
+	}
+	c.currentGroup = &g
+	nums := make([]int64, 0, len(lines))
+	for _, line := range lines {
+		n, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		if err != nil {
+			return g, nil, fmt.Errorf("invalid article number %q", line)
+		}
+		nums = append(nums, n)
+	}
+	return g, nums, nil
+}
+
+// Article grabs an article
+//
+// The reader has to be read to its end or closed, which discards the
+// rest, before the client is used again.
+func (c *Client) Article(specifier string) (int64, string, io.ReadCloser, error) {
+	return c.ArticleContext(context.Background(), specifier)
+}
+
+// ArticleContext is like Article, but gives up once ctx is done, leaving
+// the connection broken. The context applies until the reader is done.
+func (c *Client) ArticleContext(ctx context.Context, specifier string) (int64, string, io.ReadCloser, error) {
+	n, msgID, r, err := c.articleish(ctx, "ARTICLE", specifier, 220)
+	if err != nil || !c.DecodeCharset {
+		return n, msgID, r, err
+	}
+	d, err := decodeArticle(r)
+	if err != nil {
+		r.Close()
+		return 0, "", nil, err
+	}
+	return n, msgID, readCloser{d, r}, nil
+}
+
+// ArticleParsed grabs an article and parses its headers. The article's
+// Body reads the rest of the article, from just after the empty line
+// ending the headers; Bytes and Lines are not set.
+//
+// The body has to be read to its end or closed (it's an io.ReadCloser)
+// before the client is used again.
+func (c *Client) ArticleParsed(specifier string) (int64, *nntp.Article, error) {
+	n, _, r, err := c.Article(specifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	br := bufio.NewReader(r)
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		r.Close()
+		return 0, nil, err
+	}
+	return n, &nntp.Article{Header: header, Body: readCloser{br, r}}, nil
+}
+
+// Head gets the headers for an article
+//
+// The reader has to be read to its end or closed, which discards the
+// rest, before the client is used again.
+func (c *Client) Head(specifier string) (int64, string, io.ReadCloser, error) {
+	return c.HeadContext(context.Background(), specifier)
+}
+
+// HeadContext is like Head, but gives up once ctx is done, leaving the
+// connection broken. The context applies until the reader is done.
+func (c *Client) HeadContext(ctx context.Context, specifier string) (int64, string, io.ReadCloser, error) {
+	return c.articleish(ctx, "HEAD", specifier, 221)
+}
+
+// Body gets the body of an article
+//
+// The reader has to be read to its end or closed, which discards the
+// rest, before the client is used again.
+func (c *Client) Body(specifier string) (int64, string, io.ReadCloser, error) {
+	return c.BodyContext(context.Background(), specifier)
+}
+
+// BodyContext is like Body, but gives up once ctx is done, leaving the
+// connection broken. The context applies until the reader is done.
+func (c *Client) BodyContext(ctx context.Context, specifier string) (int64, string, io.ReadCloser, error) {
+	return c.articleish(ctx, "BODY", specifier, 222)
+}
+
+// Stat checks that an article exists without retrieving it, and returns
+// its number and message-id.
+func (c *Client) Stat(specifier string) (int64, string, error) {
+	return c.StatContext(context.Background(), specifier)
+}
+
+// StatContext is like Stat, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) StatContext(ctx context.Context, specifier string) (n int64, msgID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { err = stop(err) }()
+	n, err = retry(ctx, c, func() (int64, error) {
+		n, id, err := c.stat("STAT "+specifier, map[int]error{423: ErrNoSuchArticle, 430: ErrNoSuchArticle})
+		msgID = id
+		return n, err
+	})
+	return n, msgID, err
+}
+
+// Next moves the current article pointer to the next article in the
+// group, and returns its number and message-id. A group must have been
+// selected with Group first.
+func (c *Client) Next() (int64, string, error) {
+	return c.NextContext(context.Background())
+}
+
+// NextContext is like Next, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) NextContext(ctx context.Context) (n int64, msgID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		n, msgID, err = c.stat("NEXT", map[int]error{421: ErrNoNextArticle})
+		return err
+	})
+	return n, msgID, err
+}
+
+// Last moves the current article pointer to the previous article in the
+// group, and returns its number and message-id. A group must have been
+// selected with Group first.
+func (c *Client) Last() (int64, string, error) {
+	return c.LastContext(context.Background())
+}
+
+// LastContext is like Last, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) LastContext(ctx context.Context) (n int64, msgID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		n, msgID, err = c.stat("LAST", map[int]error{422: ErrNoPrevArticle})
+		return err
+	})
+	return n, msgID, err
+}
+
+// stat issues a command answered by 223 with an article number and
+// message-id. Responses with a code in codeErrs give the mapped error,
+// wrapping the response.
+func (c *Client) stat(cmd string, codeErrs map[int]error) (int64, string, error) {
+	_, msg, err := c.command(cmd, 223)
+	if e, ok := err.(nntp.Error); ok && codeErrs[e.Code] != nil {
+		return 0, "", fmt.Errorf("%w: %w", codeErrs[e.Code], err)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	parts := strings.SplitN(msg, " ", 2)
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) < 2 {
+		return 0, "", errors.New("Don't know how to parse result: " + msg)
+	}
+	return n, parts[1], nil
+}
+
+// verifyPostBackoff is the first delay between the STAT requests of
+// VerifyPost, doubled after each.
+var verifyPostBackoff = 100 * time.Millisecond
+
+// VerifyPost checks that a posted article has become available, as
+// servers may accept an article before storing it. It polls with STAT,
+// backing off exponentially, and returns false if the article doesn't
+// appear within timeout.
+func (c *Client) VerifyPost(msgID string, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := verifyPostBackoff
+	for {
+		_, _, err := c.Stat(msgID)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ErrNoSuchArticle) {
+			return false, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff *= 2
+	}
+}
+
+// WriteArticle fetches an article and copies it to w, returning the
+// article number and message-id.
+//
+// The response is always read to its end, even if writing to w fails,
+// so the connection stays usable.
+func (c *Client) WriteArticle(specifier string, w io.Writer) (int64, string, error) {
+	n, msgID, r, err := c.Article(specifier)
+	if err != nil {
+		return 0, "", err
+	}
+	_, err = io.Copy(w, r)
+	if err != nil {
+		io.Copy(io.Discard, r)
+		return 0, "", err
+	}
+	return n, msgID, nil
+}
+
+// FetchBestEffort fetches the body of an article by its number in
+// group, falling back to its message-id if the number no longer
+// resolves (423, or 411 if the group is gone), as happens when the
+// overview data the number came from is stale. If both fail, the error
+// combines both failures.
+//
+// Closing the returned reader discards the rest of the body, so the
+// client can be used again.
+func (c *Client) FetchBestEffort(group string, num int64, msgID string) (io.ReadCloser, error) {
+	_, err := c.Group(group)
+	if err == nil {
+		var r io.ReadCloser
+		_, _, r, err = c.Body(strconv.FormatInt(num, 10))
+		if err == nil {
+			return r, nil
+		}
+	}
+	if e, ok := err.(nntp.Error); !ok || (e.Code != 411 && e.Code != 423) || msgID == "" {
+		return nil, err
+	}
+	_, _, r, idErr := c.Body(msgID)
+	if idErr != nil {
+		return nil, errors.Join(fmt.Errorf("by number: %w", err), fmt.Errorf("by message-id: %w", idErr))
+	}
+	return r, nil
+}
+
+// readCloser combines a reader with the Close of the reader it reads.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// articleish issues an article command (ARTICLE, HEAD or BODY) and
+// reads the response. c.mu is held until the returned reader is done.
+func (c *Client) articleish(ctx context.Context, cmd, specifier string, expected int) (int64, string, io.ReadCloser, error) {
+	c.mu.Lock()
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		c.mu.Unlock()
+		return 0, "", nil, err
+	}
+	fail := func(err error) (int64, string, io.ReadCloser, error) {
+		err = stop(err)
+		c.mu.Unlock()
+		return 0, "", nil, err
+	}
+	msg, err := retry(ctx, c, func() (string, error) {
+		_, msg, err := c.command(cmd+" "+specifier, expected)
+		return msg, err
+	})
+	if err != nil {
+		return fail(err)
+	}
+	parts := strings.SplitN(msg, " ", 2)
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fail(err)
+	}
+	return n, parts[1], &blockReader{c: c, r: c.conn.DotReader(), stop: stop}, nil
+}
+
+// Post a new article
+//
+// The reader should contain the entire article, headers and body in
+// RFC822ish format.
+func (c *Client) Post(r io.Reader) error {
+	return c.PostContext(context.Background(), r)
+}
+
+// PostContext is like Post, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) PostContext(ctx context.Context, r io.Reader) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.PostingAllowed {
+		return ErrPostingNotAllowed
+	}
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = stop(err) }()
+	err = c.postPhase(PostPrompt, func() error {
+		err := c.send("POST")
+		if err != nil {
+			return err
+		}
+		_, _, err = c.readCodeLine(340)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = c.postPhase(PostBody, func() error {
+		w := c.conn.DotWriter()
+		_, err := io.Copy(w, r)
+		if err != nil {
+			// This seems really bad
+			return err
+		}
+		return w.Close()
+	})
+	if err != nil {
+		return err
+	}
+	return c.postPhase(PostResponse, func() error {
+		_, _, err := c.readCodeLine(240)
+		return err
+	})
+}
+
+// Errors returned by IHave, wrapping the server's response: the server
+// doesn't want the article (435), can't take it now (436, the article
+// should be offered again later), or rejected it (437).
+var (
+	ErrIHaveNotWanted = errors.New("article not wanted")
+	ErrIHaveDeferred  = errors.New("transfer not possible, try again later")
+	ErrIHaveRejected  = errors.New("transfer rejected")
+)
+
+// IHave offers an article to a peer with IHAVE, and sends it if the
+// peer wants it. The article is read from r, headers included.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-6.3.2
+func (c *Client) IHave(id string, r io.Reader) error {
+	return c.IHaveContext(context.Background(), id, r)
+}
+
+// IHaveContext is like IHave, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) IHaveContext(ctx context.Context, id string, r io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.withContext(ctx, func() error {
+		if _, _, err := c.command("IHAVE "+id, 335); err != nil {
+			return ihaveError(err)
+		}
+		w := c.conn.DotWriter()
+		if _, err := io.Copy(w, r); err != nil {
+			// The peer would take the partial article.
+			c.broken = true
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		_, _, err := c.readCodeLine(235)
+		return ihaveError(err)
+	})
+}
+
+// ihaveError maps the error responses of IHAVE to their sentinel errors.
+func ihaveError(err error) error {
+	if e, ok := err.(nntp.Error); ok {
+		switch e.Code {
+		case 435:
+			return fmt.Errorf("%w: %w", ErrIHaveNotWanted, err)
+		case 436:
+			return fmt.Errorf("%w: %w", ErrIHaveDeferred, err)
+		case 437:
+			return fmt.Errorf("%w: %w", ErrIHaveRejected, err)
+		}
+	}
+	return err
+}
+
+// A PostPhase is a step of the POST exchange.
+type PostPhase int
+
+const (
+	// PostPrompt is waiting for the 340 response to POST.
+	PostPrompt PostPhase = iota
+	// PostBody is sending the article.
+	PostBody
+	// PostResponse is waiting for the response to the article.
+	PostResponse
+)
+
+func (p PostPhase) String() string {
+	switch p {
+	case PostPrompt:
+		return "prompt"
+	case PostBody:
+		return "body"
+	case PostResponse:
+		return "response"
+	}
+	return fmt.Sprintf("PostPhase(%d)", int(p))
+}
+
+// PostTimeoutError is returned by Post when a phase exceeds the client's
+// PostTimeout. The connection is closed, as its state is unknown.
+type PostTimeoutError struct {
+	Phase PostPhase
+	Err   error
+}
+
+func (e *PostTimeoutError) Error() string {
+	return fmt.Sprintf("POST timed out in the %s phase: %v", e.Phase, e.Err)
+}
+
+func (e *PostTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true, like the timeout errors of package net.
+func (e *PostTimeoutError) Timeout() bool {
+	return true
+}
+
+// postPhase runs one phase of Post within the client's PostTimeout.
+func (c *Client) postPhase(phase PostPhase, f func() error) error {
+	if c.PostTimeout <= 0 || c.netconn == nil {
+		return f()
+	}
+	deadline := time.Now().Add(c.PostTimeout)
+	c.updateDeadline(func(d *deadlines) { d.post = deadline })
+	defer c.updateDeadline(func(d *deadlines) { d.post = time.Time{} })
+	err := f()
+	var ne net.Error
+	// Otherwise, the timeout is the context's.
+	if errors.As(err, &ne) && ne.Timeout() && !time.Now().Before(deadline) {
+		c.broken = true
+		if c.closed.CompareAndSwap(false, true) {
+			c.conn.Close()
+		}
+		return &PostTimeoutError{Phase: phase, Err: err}
+	}
+	return err
+}
+
+// Command sends a low-level command and get a response.
+//
+// This will return an error if the code doesn't match the expectCode
+// prefix.  For example, if you specify "200", the response code MUST
+// be 200 or you'll get an error.  If you specify "2", any code from
+// 200 (inclusive) to 300 (exclusive) will be success.  An expectCode
+// of -1 disables this behavior.
+func (c *Client) Command(cmd string, expectCode int) (int, string, error) {
+	return c.CommandContext(context.Background(), cmd, expectCode)
+}
+
+// CommandContext is like Command, but gives up once ctx is done, leaving
+// the connection broken.
+func (c *Client) CommandContext(ctx context.Context, cmd string, expectCode int) (code int, msg string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
 	if err != nil {
-		return 0, "", nil, err
+		return 0, "", err
 	}
-	return c.articleish(220)
+	defer func() { err = stop(err) }()
+	return c.command(cmd, expectCode)
 }
 
-// Head gets the headers for an article
-func (c *Client) Head(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("HEAD %s", specifier)
+func (c *Client) command(cmd string, expectCode int) (int, string, error) {
+	err := c.send("%s", cmd)
 	if err != nil {
-		return 0, "", nil, err
+		return 0, "", err
 	}
-	return c.articleish(221)
+	return c.readCodeLine(expectCode)
 }
 
-// Body gets the body of an article
-func (c *Client) Body(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("BODY %s", specifier)
+// DataCommand sends a low-level command whose response carries a data
+// block, and returns the status line along with the block's lines. The
+// block is subject to the client's response limits.
+//
+// expectCode works as for Command. The caller is responsible for
+// knowing that the command returns a block on success: if it doesn't,
+// the next status line is read as data, and the connection is left in
+// an unknown state.
+func (c *Client) DataCommand(cmd string, expectCode int) (int, string, []string, error) {
+	return c.DataCommandContext(context.Background(), cmd, expectCode)
+}
+
+// DataCommandContext is like DataCommand, but gives up once ctx is done,
+// leaving the connection broken.
+func (c *Client) DataCommandContext(ctx context.Context, cmd string, expectCode int) (code int, msg string, lines []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
 	if err != nil {
 		return 0, "", nil, err
 	}
-	return c.articleish(222)
+	defer func() { err = stop(err) }()
+	return c.dataCommand(cmd, expectCode)
 }
 
-func (c *Client) articleish(expected int) (int64, string, io.Reader, error) {
-	_, msg, err := c.conn.ReadCodeLine(expected)
+func (c *Client) dataCommand(cmd string, expectCode int) (int, string, []string, error) {
+	code, msg, err := c.command(cmd, expectCode)
 	if err != nil {
-		return 0, "", nil, err
+		return code, msg, nil, err
 	}
-	parts := strings.SplitN(msg, " ", 2)
-	n, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, "", nil, err
+	lines, err := c.readBlock(msg)
+	return code, msg, lines, err
+}
+
+// asLines issues a command and returns the response's data block as lines.
+func (c *Client) asLines(cmd string, expectCode int) ([]string, error) {
+	_, _, lines, err := c.dataCommand(cmd, expectCode)
+	return lines, err
+}
+
+// readCodeLine reads a status line, like textproto.Conn.ReadCodeLine,
+// except that error responses are returned as nntp.Error.
+func (c *Client) readCodeLine(expectCode int) (int, string, error) {
+	code, msg, err := c.conn.ReadCodeLine(expectCode)
+	return code, msg, responseError(err)
+}
+
+// responseError converts the *textproto.Error returned for an unexpected
+// status code to an nntp.Error. Other errors are returned as is.
+func responseError(err error) error {
+	if e, ok := err.(*textproto.Error); ok {
+		return nntp.Error{Code: e.Code, Msg: e.Msg}
 	}
-	return n, parts[1], c.conn.DotReader(), nil
+	return err
 }
 
-// Post a new article
-//
-// The reader should contain the entire article, headers and body in
-// RFC822ish format.
-func (c *Client) Post(r io.Reader) error {
-	err := c.conn.PrintfLine("POST")
-	if err != nil {
-		return err
+// send writes a command line, unless the connection is broken or
+// closed.
+func (c *Client) send(format string, args ...interface{}) error {
+	if c.broken {
+		return ErrConnectionBroken
 	}
-	_, _, err = c.conn.ReadCodeLine(340)
-	if err != nil {
-		return err
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	return c.conn.PrintfLine(format, args...)
+}
+
+// readBlock reads the data block following the status line msg, subject
+// to the client's response limits.
+func (c *Client) readBlock(msg string) ([]string, error) {
+	var lines []string
+	var err error
+	if c.xfeatureGzip && strings.HasSuffix(msg, xfeatureGzipMarker) {
+		lines, err = c.readGzipBlock()
+	} else {
+		lines, err = readDotBlock(&c.conn.Reader, c.MaxResponseBytes, c.MaxResponseLines)
 	}
-	w := c.conn.DotWriter()
-	_, err = io.Copy(w, r)
 	if err != nil {
-		// This seems really bad
-		return err
+		if _, ok := err.(*ResponseTooLargeError); !ok {
+			c.broken = true
+		}
 	}
-	w.Close()
-	_, _, err = c.conn.ReadCodeLine(240)
+	return lines, err
+}
+
+// blockReader marks the client broken if reading a data block fails,
+// and releases the client once the block is done.
+type blockReader struct {
+	c    *Client
+	r    io.Reader
+	done bool
+	// Called with the final error, if set.
+	stop func(error) error
+}
+
+// Close discards the rest of the block, so that the client can be used
+// again.
+func (b *blockReader) Close() error {
+	_, err := io.Copy(io.Discard, b)
 	return err
 }
 
-// Command sends a low-level command and get a response.
-//
-// This will return an error if the code doesn't match the expectCode
-// prefix.  For example, if you specify "200", the response code MUST
-// be 200 or you'll get an error.  If you specify "2", any code from
-// 200 (inclusive) to 300 (exclusive) will be success.  An expectCode
-// of -1 disables this behavior.
-func (c *Client) Command(cmd string, expectCode int) (int, string, error) {
-	err := c.conn.PrintfLine(cmd)
+func (b *blockReader) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+	n, err := b.r.Read(p)
 	if err != nil {
-		return 0, "", err
+		if b.stop != nil {
+			err = b.stop(err)
+		}
+		if err != io.EOF {
+			b.c.broken = true
+		}
+		b.done = true
+		b.c.mu.Unlock()
 	}
-	return c.conn.ReadCodeLine(expectCode)
+	return n, err
 }
 
-// asLines issues a command and returns the response's data block as lines.
-func (c *Client) asLines(cmd string, expectCode int) ([]string, error) {
-	_, _, err := c.Command(cmd, expectCode)
-	if err != nil {
-		return nil, err
+// readDotBlock reads a dot-encoded data block and returns the decoded lines.
+//
+// If the block has more than maxLines lines or more than maxBytes bytes
+// (a limit of zero disables the check), the remainder of the block is
+// discarded and a *ResponseTooLargeError is returned.
+func readDotBlock(r *textproto.Reader, maxBytes, maxLines int) ([]string, error) {
+	var lines []string
+	var size int
+	overflow := false
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if line == "." {
+			break
+		}
+		if overflow {
+			continue
+		}
+		// Undo dot-stuffing.
+		if strings.HasPrefix(line, ".") {
+			line = line[1:]
+		}
+		size += len(line)
+		if (maxLines > 0 && len(lines) >= maxLines) || (maxBytes > 0 && size > maxBytes) {
+			overflow = true
+			lines = nil
+			continue
+		}
+		lines = append(lines, line)
 	}
-	return c.conn.ReadDotLines()
+	if overflow {
+		return nil, &ResponseTooLargeError{MaxBytes: maxBytes, MaxLines: maxLines}
+	}
+	return lines, nil
+}
+
+// Help retrieves the server's help text, whose lines are returned as
+// sent, leading and trailing whitespace included.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-7.2
+func (c *Client) Help() ([]string, error) {
+	return c.HelpContext(context.Background())
+}
+
+// HelpContext is like Help, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) HelpContext(ctx context.Context) (lines []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		lines, err = c.help()
+		return err
+	})
+	return lines, err
+}
+
+func (c *Client) help() ([]string, error) {
+	return c.asLines("HELP", 100)
 }
 
 // Capabilities retrieves a list of supported capabilities.
 //
 // See https://datatracker.ietf.org/doc/html/rfc3977#section-5.2.2
 func (c *Client) Capabilities() ([]string, error) {
+	return c.CapabilitiesContext(context.Background())
+}
+
+// CapabilitiesContext is like Capabilities, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) CapabilitiesContext(ctx context.Context) (caps []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		caps, err = c.fetchCapabilities()
+		return err
+	})
+	return caps, err
+}
+
+func (c *Client) fetchCapabilities() ([]string, error) {
 	caps, err := c.asLines("CAPABILITIES", 101)
 	if err != nil {
 		return nil, err
@@ -284,10 +1458,35 @@ func (c *Client) Capabilities() ([]string, error) {
 	for i, line := range caps {
 		caps[i] = strings.ToUpper(line)
 	}
+	// The overview format may change with the capabilities (e.g. after
+	// authentication).
+	if c.capabilities != nil {
+		c.overviewFmt = nil
+	}
 	c.capabilities = caps
 	return caps, nil
 }
 
+// commandName returns the name of a command, or its X-prefixed legacy
+// spelling (XOVER, XHDR) if the server doesn't advertise it. Servers
+// that don't know CAPABILITIES (500 or 501) are taken to predate RFC
+// 3977; other errors, such as 480, are returned, so that capabilities
+// are retrieved again next time.
+func (c *Client) commandName(name string) (string, error) {
+	if c.capabilities == nil {
+		_, err := c.fetchCapabilities()
+		if ne, ok := err.(nntp.Error); ok && (ne.Code == 500 || ne.Code == 501) {
+			c.capabilities = []string{}
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if c.getCapability(name) == "" {
+		return "X" + name, nil
+	}
+	return name, nil
+}
+
 // GetCapability returns a complete capability line.
 //
 // "Each capability line consists of one or more tokens, which MUST be
@@ -295,6 +1494,12 @@ func (c *Client) Capabilities() ([]string, error) {
 //
 // From https://datatracker.ietf.org/doc/html/rfc3977#section-3.3.1
 func (c *Client) GetCapability(capability string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getCapability(capability)
+}
+
+func (c *Client) getCapability(capability string) string {
 	capability = strings.ToUpper(capability)
 	for _, capa := range c.capabilities {
 		i := strings.IndexAny(capa, "\t ")
@@ -318,10 +1523,16 @@ func (c *Client) GetCapability(capability string) string {
 func (c *Client) HasCapabilityArgument(
 	capability, argument string,
 ) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hasCapabilityArgument(capability, argument)
+}
+
+func (c *Client) hasCapabilityArgument(capability, argument string) (bool, error) {
 	if c.capabilities == nil {
 		return false, errors.New("Capabilities unpopulated")
 	}
-	capLine := c.GetCapability(capability)
+	capLine := c.getCapability(capability)
 	if capLine == "" {
 		return false, errors.New("No such capability")
 	}
@@ -334,6 +1545,57 @@ func (c *Client) HasCapabilityArgument(
 	return false, nil
 }
 
+// AuthMethods reports which AUTHINFO variants the server advertises:
+// whether AUTHINFO USER is available, and the mechanisms offered for
+// AUTHINFO SASL, if any. Capabilities must have been retrieved first.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4643#section-2.1
+func (c *Client) AuthMethods() (user bool, sasl []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authMethods()
+}
+
+func (c *Client) authMethods() (user bool, sasl []string) {
+	hasSASL := false
+	for _, arg := range strings.Fields(c.getCapability("AUTHINFO")) {
+		switch arg {
+		case "USER":
+			user = true
+		case "SASL":
+			hasSASL = true
+		}
+	}
+	if fields := strings.Fields(c.getCapability("SASL")); hasSASL && len(fields) > 1 {
+		sasl = fields[1:]
+	}
+	return user, sasl
+}
+
+// MaxPostSize returns the largest article size in bytes the server
+// accepts, if it advertises one.
+//
+// There is no standard capability for this, so the label is taken from
+// MaxPostSizeCapability and the size is its first argument, e.g.
+// "MAXARTSIZE 1000000". Capabilities must have been retrieved first.
+func (c *Client) MaxPostSize() (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	label := c.MaxPostSizeCapability
+	if label == "" {
+		label = DefaultMaxPostSizeCapability
+	}
+	fields := strings.Fields(c.getCapability(label))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size <= 0 {
+		return 0, false
+	}
+	return size, true
+}
+
 // ListOverviewFmt performs a LIST OVERVIEW.FMT query.
 //
 // According to the spec, the presence of an "OVER" line in the capabilities
@@ -342,6 +1604,8 @@ func (c *Client) HasCapabilityArgument(
 //
 // See https://datatracker.ietf.org/doc/html/rfc3977#section-3.3.2
 func (c *Client) ListOverviewFmt() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	fields, err := c.asLines("LIST OVERVIEW.FMT", 215)
 	if err != nil {
 		return nil, err
@@ -360,78 +1624,522 @@ References header content
 :lines metadata item
 */
 type OverItem struct {
-	Number        string
-	From          string
-	Subject       string
-	Date          string
-	MessageId     string
-	References    string
-	bytesMetadata string
-	linesMetadata string
+	Number     int64
+	From       string
+	Subject    string
+	Date       string
+	MessageId  string
+	References string
+	// Bytes and Lines are the :bytes and :lines metadata items, or zero
+	// if the server didn't send them.
+	Bytes int64
+	Lines int64
+	// Extra holds the fields beyond the standard ones (e.g. "Xref") by
+	// name, if the overview format is known (see OverStructured).
+	Extra map[string]string
+}
+
+// LoadOverviewFmt retrieves the overview format with LIST OVERVIEW.FMT
+// and caches it, so that Over maps the fields of overview data by name
+// rather than by their standard positions.
+//
+// The cache is dropped when capabilities are retrieved again; calling
+// LoadOverviewFmt again refreshes it.
+func (c *Client) LoadOverviewFmt() (*nntp.OverviewFmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loadOverviewFmt()
+}
+
+func (c *Client) loadOverviewFmt() (*nntp.OverviewFmt, error) {
+	lines, err := c.asLines("LIST OVERVIEW.FMT", 215)
+	if err != nil {
+		return nil, err
+	}
+	format, err := nntp.ParseOverviewFmt(lines)
+	if err != nil {
+		return nil, err
+	}
+	c.overviewFmt = format
+	return format, nil
+}
+
+// parseOverItem maps the fields of an overview line (the article number
+// followed by the fields listed in format).
+func parseOverItem(fields []string, format *nntp.OverviewFmt) OverItem {
+	get := func(name string) string {
+		i := format.Index(name) + 1
+		if i == 0 || i >= len(fields) {
+			return ""
+		}
+		value := fields[i]
+		if format.Fields[i-1].Full {
+			// Strip the header name.
+			if colon := strings.IndexByte(value, ':'); colon >= 0 {
+				value = strings.TrimSpace(value[colon+1:])
+			}
+		}
+		return value
+	}
+	getInt := func(name string) int64 {
+		n, _ := strconv.ParseInt(get(name), 10, 64)
+		return n
+	}
+	n, _ := strconv.ParseInt(fields[0], 10, 64)
+	item := OverItem{
+		Number:     n,
+		Subject:    get("Subject"),
+		From:       get("From"),
+		Date:       get("Date"),
+		MessageId:  get("Message-ID"),
+		References: get("References"),
+		Bytes:      getInt(":bytes"),
+		Lines:      getInt(":lines"),
+	}
+	for _, field := range format.Fields {
+		if nntp.DefaultOverviewFmt.Index(field.Name) >= 0 {
+			continue
+		}
+		if item.Extra == nil {
+			item.Extra = make(map[string]string)
+		}
+		item.Extra[field.Name] = get(field.Name)
+	}
+	return item
 }
 
 // Over returns a list of raw overview lines with tab-separated fields.
+//
+// The fields are mapped using the format cached by LoadOverviewFmt, or
+// the standard format if none is cached.
+//
+// XOVER is used instead if the server doesn't advertise OVER.
 func (c *Client) Over(args ...int) ([]OverItem, error) {
-	cmd := ""
+	return c.OverContext(context.Background(), args...)
+}
+
+// OverContext is like Over, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) OverContext(ctx context.Context, args ...int) (items []OverItem, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = stop(err) }()
+	return retry(ctx, c, func() ([]OverItem, error) {
+		return c.overArgs(args)
+	})
+}
+
+// OverStructured is like Over, but first retrieves the overview format
+// with LIST OVERVIEW.FMT, unless LoadOverviewFmt has cached it already.
+// This maps the fields correctly on servers that reorder the optional
+// fields or add their own, which are returned in the items' Extra
+// field.
+func (c *Client) OverStructured(args ...int) ([]OverItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overviewFmt == nil {
+		if _, err := c.loadOverviewFmt(); err != nil {
+			return nil, err
+		}
+	}
+	return c.overArgs(args)
+}
+
+// OverMessageID returns the overview data of the article with the given
+// message-id, which doesn't need a group to be selected. The article
+// number is 0. ErrNoSuchArticle is returned if there's no such article
+// (430).
+//
+// The server has to advertise MSGID in its OVER capability, as XOVER
+// doesn't take a message-id; capabilities are retrieved first if
+// necessary.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-8.3
+func (c *Client) OverMessageID(id string) (OverItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capabilities == nil {
+		if _, err := c.fetchCapabilities(); err != nil {
+			return OverItem{}, err
+		}
+	}
+	ok, err := c.hasCapabilityArgument("OVER", "MSGID")
+	if err != nil || !ok {
+		return OverItem{}, errors.New("OVER MSGID not supported by server")
+	}
+	items, err := c.over("OVER " + id)
+	if e, ok := err.(nntp.Error); ok && e.Code == 430 {
+		return OverItem{}, fmt.Errorf("%w: %w", ErrNoSuchArticle, err)
+	}
+	if err != nil {
+		return OverItem{}, err
+	}
+	if len(items) != 1 {
+		return OverItem{}, fmt.Errorf("got %d overview lines for %s, wanted 1", len(items), id)
+	}
+	return items[0], nil
+}
+
+func (c *Client) overArgs(args []int) ([]OverItem, error) {
+	arg, err := rangeArg(args)
+	if err != nil {
+		return nil, err
+	}
+	// XOVER answers with 224 as well.
+	cmd, err := c.commandName("OVER")
+	if err != nil {
+		return nil, err
+	}
+	if arg != "" {
+		cmd += " " + arg
+	}
+	return c.over(cmd)
+}
+
+// Hdr returns the content of a header (or a metadata item such as
+// ":bytes") for the articles selected by specifier: an article number, a
+// range ("first-last" or "first-"), or a message-id. An empty specifier
+// selects the current article.
+//
+// Each line is the article number (0 for a message-id), a space and the
+// content; the lines are returned as sent.
+//
+// XHDR is used instead if the server doesn't advertise HDR.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-8.5
+func (c *Client) Hdr(header, specifier string) ([]string, error) {
+	return c.HdrContext(context.Background(), header, specifier)
+}
+
+// HdrContext is like Hdr, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) HdrContext(ctx context.Context, header, specifier string) (lines []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = stop(err) }()
+	return retry(ctx, c, func() ([]string, error) {
+		name, err := c.commandName("HDR")
+		if err != nil {
+			return nil, err
+		}
+		cmd := name + " " + header
+		if specifier != "" {
+			cmd += " " + specifier
+		}
+		// XHDR answers with 221.
+		expectCode := 225
+		if name == "XHDR" {
+			expectCode = 221
+		}
+		return c.asLines(cmd, expectCode)
+	})
+}
+
+// rangeArg formats the optional article number or range argument of
+// Over and similar methods: none, a number, or the first and last
+// numbers of a range.
+func rangeArg(args []int) (string, error) {
 	switch len(args) {
 	case 0:
-		cmd = "OVER"
+		return "", nil
 	case 1:
-		cmd = fmt.Sprintf("OVER %d", args[0])
+		return strconv.Itoa(args[0]), nil
 	case 2:
-		cmd = fmt.Sprintf("OVER %d-%d", args[0], args[1])
-	default:
-		return nil, errors.New("Invalid arguments, either 1 or 2 numbers for an item, for a range")
+		return fmt.Sprintf("%d-%d", args[0], args[1]), nil
 	}
+	return "", errors.New("Invalid arguments, either 1 or 2 numbers for an item, for a range")
+}
 
-	// fmt.Sprintf("%d-%d", a.Low, a.High)
+// over issues an OVER command and parses the response.
+func (c *Client) over(cmd string) ([]OverItem, error) {
 	lines, err := c.asLines(cmd, 224)
 	if err != nil {
 		return nil, err
 	}
+	format := c.overviewFmt
+	if format == nil {
+		format = nntp.DefaultOverviewFmt
+	}
 	ret := []OverItem{}
 	for _, item := range lines {
 		splitItem := strings.Split(item, "\t")
-		slog.Debug("Split Items:", "items", splitItem)
-		if len(splitItem) < 5 {
+		c.logger().Debug("overview line", "fields", splitItem)
+		// Missing trailing fields are left empty.
+		if _, err := strconv.ParseInt(splitItem[0], 10, 64); err != nil {
 			continue
 		}
-		ret = append(ret, OverItem{
-			Number:        splitItem[0],
-			Subject:       splitItem[1],
-			From:          splitItem[2],
-			Date:          splitItem[3],
-			MessageId:     splitItem[4],
-			References:    splitItem[5],
-			bytesMetadata: splitItem[6],
-			linesMetadata: splitItem[7],
-		})
+		ret = append(ret, parseOverItem(splitItem, format))
 	}
 	return ret, nil
 }
 
+// ArticleSize returns the size in bytes of an article in a group, taken
+// from its overview data rather than by fetching it. The group is
+// selected first.
+//
+// An error is returned if the overview data lacks the :bytes item.
+func (c *Client) ArticleSize(group string, num int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.group(group); err != nil {
+		return 0, err
+	}
+	items, err := c.over(fmt.Sprintf("OVER %d", num))
+	if err != nil {
+		return 0, err
+	}
+	if len(items) != 1 || items[0].Bytes == 0 {
+		return 0, errors.New("No article size in overview data")
+	}
+	return items[0].Bytes, nil
+}
+
+// UnreadCount returns how many of the overview items are not covered by
+// any of the read article number ranges. Each range holds the first and
+// last number it covers; ranges may overlap. Items numbered 0 (as sent
+// for a message-id) are not counted.
+func UnreadCount(items []OverItem, readRanges [][2]int64) int {
+	unread := 0
+	for _, item := range items {
+		n := item.Number
+		if n <= 0 {
+			continue
+		}
+		read := false
+		for _, r := range readRanges {
+			if r[0] <= n && n <= r[1] {
+				read = true
+				break
+			}
+		}
+		if !read {
+			unread++
+		}
+	}
+	return unread
+}
+
+// ProbeAccess selects a group and tries single-article forms of ARTICLE
+// (using HEAD), OVER, HDR and LISTGROUP on its first article, reporting
+// which of them the server actually honors for the group.
+//
+// Some servers advertise capabilities they then refuse for some groups.
+// A command refused with an error response is reported as false; err is
+// only set if the group can't be selected or the connection fails. For
+// an empty group nothing can be probed and all results are false.
+func (c *Client) ProbeAccess(group string) (canArticle, canOver, canHdr, canListgroup bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, err := c.group(group)
+	if err != nil {
+		return false, false, false, false, err
+	}
+	if g.Count == 0 || g.Low > g.High {
+		return false, false, false, false, nil
+	}
+	n := g.Low
+	if canArticle, err = c.probe(221, "HEAD %d", n); err != nil {
+		return
+	}
+	if canOver, err = c.probe(224, "OVER %d-%d", n, n); err != nil {
+		return
+	}
+	if canHdr, err = c.probe(225, "HDR Subject %d-%d", n, n); err != nil {
+		return
+	}
+	canListgroup, err = c.probe(211, "LISTGROUP %s %d-%d", group, n, n)
+	return
+}
+
+// probe issues a command with a multi-line response and discards the
+// response. It reports false, without error, if the server answers with
+// another code.
+func (c *Client) probe(expectCode int, format string, args ...interface{}) (bool, error) {
+	if err := c.send(format, args...); err != nil {
+		return false, err
+	}
+	_, msg, err := c.readCodeLine(expectCode)
+	if err != nil {
+		if _, ok := err.(nntp.Error); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := c.readBlock(msg); err != nil {
+		if _, ok := err.(*ResponseTooLargeError); !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Ping checks that the connection is still alive with a DATE command,
+// returning the error otherwise, so that e.g. a pool can discard the
+// client. It waits for any exchange in progress to finish first.
+func (c *Client) Ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, err := c.command("DATE", 111)
+	return err
+}
+
+// Date returns the server's current time, in UTC.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3977#section-7.1
+func (c *Client) Date() (time.Time, error) {
+	return c.DateContext(context.Background())
+}
+
+// DateContext is like Date, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) DateContext(ctx context.Context) (t time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		t, err = c.date()
+		return err
+	})
+	return t, err
+}
+
+func (c *Client) date() (time.Time, error) {
+	_, msg, err := c.command("DATE", 111)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Some servers add text after the timestamp.
+	fields := strings.Fields(msg)
+	if len(fields) == 0 || len(fields[0]) != 14 {
+		return time.Time{}, fmt.Errorf("invalid DATE response %q", msg)
+	}
+	t, err := time.Parse("20060102150405", fields[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DATE response %q: %w", msg, err)
+	}
+	return t, nil
+}
+
 func (c *Client) HasTLS() bool {
 	return c.tls
 }
 
+// NetConn returns the client's network connection, a *tls.Conn once TLS
+// is active, or nil if the client wasn't made with a net.Conn. Reading
+// from or writing to it desynchronizes the client.
+func (c *Client) NetConn() net.Conn {
+	c.deadlines.mu.Lock()
+	defer c.deadlines.mu.Unlock()
+	return c.netconn
+}
+
+// ConnectionState returns the state of the TLS connection, if TLS is
+// active.
+func (c *Client) ConnectionState() (tls.ConnectionState, bool) {
+	if tc, ok := c.NetConn().(*tls.Conn); ok {
+		return tc.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
 // StartTLS sends the STARTTLS command and refreshes capabilities.
 //
+// Unless the config sets ServerName or InsecureSkipVerify, the server's
+// certificate is verified against the client's ServerName.
+//
 // See https://datatracker.ietf.org/doc/html/rfc4642 and net/smtp.go, from
 // which this was adapted, and maybe NNTP.startls in Python's nntplib also.
 func (c *Client) StartTLS(config *tls.Config) error {
+	return c.StartTLSContext(context.Background(), config)
+}
+
+// StartTLSContext is like StartTLS, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) StartTLSContext(ctx context.Context, config *tls.Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.withContext(ctx, func() error {
+		return c.startTLS(config)
+	})
+}
+
+func (c *Client) startTLS(config *tls.Config) error {
 	if c.tls {
 		return errors.New("TLS already active")
 	}
-	_, _, err := c.Command("STARTTLS", 382)
+	if c.compressed {
+		return errors.New("TLS can't be started once compression is active")
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" && !config.InsecureSkipVerify && c.ServerName != "" {
+		config = config.Clone()
+		config.ServerName = c.ServerName
+	}
+	_, _, err := c.command("STARTTLS", 382)
 	if err != nil {
 		return err
 	}
+	// SetDeadline may be called concurrently.
+	c.deadlines.mu.Lock()
 	c.netconn = tls.Client(c.netconn, config)
+	c.deadlines.mu.Unlock()
 	c.conn = textproto.NewConn(c.netconn)
 	c.tls = true
-	_, err = c.Capabilities()
+	c.startTLSConfig = config
+	_, err = c.fetchCapabilities()
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// CertificateMismatchError is returned when the server's certificate
+// doesn't match the fingerprint given to PinCertificate.
+type CertificateMismatchError struct {
+	Expected []byte
+	Got      []byte
+}
+
+func (e *CertificateMismatchError) Error() string {
+	return fmt.Sprintf("server certificate SHA-256 fingerprint %x does not match pinned %x",
+		e.Got, e.Expected)
+}
+
+// PinCertificate returns a copy of config which additionally requires
+// the server's leaf certificate to have the given SHA-256 fingerprint.
+//
+// The check is made even if the certificate chain verifies (or
+// verification is disabled with InsecureSkipVerify), so a certificate
+// issued by a compromised CA is rejected. Use the returned config with
+// StartTLS, or for implicit TLS, with tls.Dial before handing the
+// connection to NewConn.
+func PinCertificate(config *tls.Config, fingerprint []byte) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	pinned := config.Clone()
+	verify := config.VerifyConnection
+	pinned.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+		if !bytes.Equal(sum[:], fingerprint) {
+			return &CertificateMismatchError{Expected: fingerprint, Got: sum[:]}
+		}
+		if verify != nil {
+			return verify(cs)
+		}
+		return nil
+	}
+	return pinned
+}
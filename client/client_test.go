@@ -0,0 +1,1296 @@
+package nntpclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+func newTestReader(s string) *textproto.Reader {
+	return textproto.NewReader(bufio.NewReader(strings.NewReader(s)))
+}
+
+func TestReadDotBlock(t *testing.T) {
+	r := newTestReader("one\r\n..two\r\nthree\r\n.\r\n")
+	lines, err := readDotBlock(r, 0, 0)
+	if err != nil {
+		t.Fatalf("Error reading block: %v", err)
+	}
+	expected := []string{"one", ".two", "three"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Got %q, wanted %q", lines, expected)
+	}
+}
+
+func TestReadDotBlockLineLimit(t *testing.T) {
+	r := newTestReader("one\r\ntwo\r\nthree\r\n.\r\nnext\r\n")
+	_, err := readDotBlock(r, 0, 2)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected ResponseTooLargeError, got %v", err)
+	}
+	// The rest of the block must have been consumed.
+	line, err := r.ReadLine()
+	if err != nil || line != "next" {
+		t.Fatalf("Block not drained, next line is %q (%v)", line, err)
+	}
+}
+
+func TestReadDotBlockByteLimit(t *testing.T) {
+	r := newTestReader("0123456789\r\n0123456789\r\n.\r\nnext\r\n")
+	_, err := readDotBlock(r, 15, 0)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected ResponseTooLargeError, got %v", err)
+	}
+	line, err := r.ReadLine()
+	if err != nil || line != "next" {
+		t.Fatalf("Block not drained, next line is %q (%v)", line, err)
+	}
+}
+
+func TestReadDotBlockTruncated(t *testing.T) {
+	r := newTestReader("one\r\ntwo\r\n")
+	_, err := readDotBlock(r, 0, 0)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+// An exchange is one step of a scripted test server conversation.
+type exchange struct {
+	// The command line the client is expected to send.
+	cmd string
+	// The raw response to send back, CRLF line endings included.
+	resp string
+}
+
+// newTestClient returns a client connected to a scripted server which
+// greets with a 200 banner and then plays back the given exchanges.
+func newTestClient(t *testing.T, script ...exchange) *Client {
+	t.Helper()
+	// A real connection, so that pipelined commands don't block.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	cconn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	sconn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Error accepting: %v", err)
+	}
+	go serveScript(t, sconn, script)
+	c, err := NewConn(cconn)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	t.Cleanup(func() { cconn.Close() })
+	return c
+}
+
+// serveScript greets with a 200 banner on a server connection, plays
+// back the exchanges, and closes the connection.
+func serveScript(t *testing.T, sconn net.Conn, script []exchange) {
+	defer sconn.Close()
+	s := textproto.NewConn(sconn)
+	s.PrintfLine("200 test server ready")
+	for _, e := range script {
+		line, err := s.ReadLine()
+		if err != nil {
+			t.Errorf("Error reading command %q: %v", e.cmd, err)
+			return
+		}
+		if line != e.cmd {
+			t.Errorf("Got command %q, wanted %q", line, e.cmd)
+			return
+		}
+		s.W.WriteString(e.resp)
+		s.W.Flush()
+	}
+}
+
+func TestGroup(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"GROUP alt.test", "211 10 20 30\r\n"},
+	)
+	g, err := c.Group("misc.test")
+	if err != nil {
+		t.Fatalf("Error selecting group: %v", err)
+	}
+	if g.Name != "misc.test" || g.Count != 3 || g.Low != 1 || g.High != 5 {
+		t.Fatalf("Unexpected group: %#v", g)
+	}
+	g, err = c.Group("alt.test")
+	if err != nil {
+		t.Fatalf("Error selecting group: %v", err)
+	}
+	if g.Name != "alt.test" || g.Count != 10 || g.Low != 20 || g.High != 30 {
+		t.Fatalf("Unexpected group: %#v", g)
+	}
+}
+
+func TestCurrentGroup(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"GROUP alt.gone", "411 no such group\r\n"},
+		exchange{"LISTGROUP alt.test", "211 1 7 7 alt.test\r\n7\r\n.\r\n"},
+	)
+	if g, ok := c.CurrentGroup(); ok {
+		t.Fatalf("Got current group %+v before selecting one", g)
+	}
+	if _, err := c.Group("misc.test"); err != nil {
+		t.Fatalf("Error selecting group: %v", err)
+	}
+	if g, ok := c.CurrentGroup(); !ok || g.Name != "misc.test" || g.High != 5 {
+		t.Fatalf("Got current group %+v, %v", g, ok)
+	}
+	// A failed GROUP leaves the group selected.
+	if _, err := c.Group("alt.gone"); err == nil {
+		t.Fatalf("Selected a missing group")
+	}
+	if g, ok := c.CurrentGroup(); !ok || g.Name != "misc.test" {
+		t.Fatalf("Got current group %+v, %v after a failed GROUP", g, ok)
+	}
+	if _, _, err := c.ListGroup("alt.test"); err != nil {
+		t.Fatalf("Error listing group: %v", err)
+	}
+	if g, ok := c.CurrentGroup(); !ok || g.Name != "alt.test" || g.Low != 7 {
+		t.Fatalf("Got current group %+v, %v after LISTGROUP", g, ok)
+	}
+}
+
+func TestGroupPadded(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211  3  1 5\tmisc.test \r\n"},
+		exchange{"GROUP misc.test", "211 3 1\r\n"},
+	)
+	g, err := c.Group("misc.test")
+	if err != nil {
+		t.Fatalf("Error selecting group: %v", err)
+	}
+	if g.Name != "misc.test" || g.Count != 3 || g.Low != 1 || g.High != 5 {
+		t.Fatalf("Unexpected group: %#v", g)
+	}
+	if _, err := c.Group("misc.test"); err == nil || !strings.Contains(err.Error(), "invalid group status") {
+		t.Fatalf("Got %v for a short status line", err)
+	}
+}
+
+func TestWriteArticle(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"ARTICLE <a@example.com>",
+			"220 3 <a@example.com>\r\nSubject: test\r\n\r\n..dotted\r\nbody\r\n.\r\n"},
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+	)
+	var buf bytes.Buffer
+	n, id, err := c.WriteArticle("<a@example.com>", &buf)
+	if err != nil {
+		t.Fatalf("Error writing article: %v", err)
+	}
+	if n != 3 || id != "<a@example.com>" {
+		t.Fatalf("Got article %d %q", n, id)
+	}
+	expected := "Subject: test\n\n.dotted\nbody\n"
+	if buf.String() != expected {
+		t.Fatalf("Got %q, wanted %q", buf.String(), expected)
+	}
+	// The connection must still be in sync.
+	if _, err := c.Group("misc.test"); err != nil {
+		t.Fatalf("Error after WriteArticle: %v", err)
+	}
+}
+
+func TestMaxPostSize(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nMAXARTSIZE 512000\r\nXSIZELIMIT 1024\r\n.\r\n"},
+	)
+	if _, ok := c.MaxPostSize(); ok {
+		t.Fatalf("Got a size before capabilities were retrieved")
+	}
+	if _, err := c.Capabilities(); err != nil {
+		t.Fatalf("Error getting capabilities: %v", err)
+	}
+	if size, ok := c.MaxPostSize(); !ok || size != 512000 {
+		t.Fatalf("Got %d, %v; wanted 512000", size, ok)
+	}
+	c.MaxPostSizeCapability = "XSIZELIMIT"
+	if size, ok := c.MaxPostSize(); !ok || size != 1024 {
+		t.Fatalf("Got %d, %v; wanted 1024", size, ok)
+	}
+	c.MaxPostSizeCapability = "NOSUCHCAP"
+	if _, ok := c.MaxPostSize(); ok {
+		t.Fatalf("Got a size for an unadvertised capability")
+	}
+}
+
+func TestTruncatedBlockBreaksConnection(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST", "215 list follows\r\nmisc.test 5 1 y\r\n"},
+	)
+	if _, err := c.List(""); err == nil {
+		t.Fatalf("Expected an error for a truncated list")
+	}
+	if _, err := c.Group("misc.test"); err != ErrConnectionBroken {
+		t.Fatalf("Expected ErrConnectionBroken, got %v", err)
+	}
+}
+
+func TestTruncatedArticleBreaksConnection(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"BODY 3", "222 3 <a@example.com>\r\nbody\r\n"},
+	)
+	_, _, r, err := c.Body("3")
+	if err != nil {
+		t.Fatalf("Error getting body: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, r); err == nil {
+		t.Fatalf("Expected an error reading a truncated body")
+	}
+	if _, err := c.Group("misc.test"); err != ErrConnectionBroken {
+		t.Fatalf("Expected ErrConnectionBroken, got %v", err)
+	}
+}
+
+func TestProbeAccess(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211 3 5 8 misc.test\r\n"},
+		exchange{"HEAD 5", "221 5 <a@example.com>\r\nSubject: test\r\n.\r\n"},
+		exchange{"OVER 5-5", "503 overview not available for this group\r\n"},
+		exchange{"HDR Subject 5-5", "225 headers follow\r\n5 test\r\n.\r\n"},
+		exchange{"LISTGROUP misc.test 5-5", "211 3 5 8 misc.test\r\n5\r\n.\r\n"},
+		exchange{"GROUP empty.test", "211 0 9 8 empty.test\r\n"},
+	)
+	canArticle, canOver, canHdr, canListgroup, err := c.ProbeAccess("misc.test")
+	if err != nil {
+		t.Fatalf("Error probing: %v", err)
+	}
+	if !canArticle || canOver || !canHdr || !canListgroup {
+		t.Fatalf("Got %v %v %v %v", canArticle, canOver, canHdr, canListgroup)
+	}
+	canArticle, canOver, canHdr, canListgroup, err = c.ProbeAccess("empty.test")
+	if err != nil || canArticle || canOver || canHdr || canListgroup {
+		t.Fatalf("Got %v %v %v %v (%v) for an empty group",
+			canArticle, canOver, canHdr, canListgroup, err)
+	}
+}
+
+func TestUnreadCount(t *testing.T) {
+	var items []OverItem
+	for _, n := range []int64{1, 2, 3, 5, 8, 9, 0} {
+		items = append(items, OverItem{Number: n})
+	}
+	tests := []struct {
+		read     [][2]int64
+		expected int
+	}{
+		{nil, 6},
+		{[][2]int64{{1, 3}}, 3},
+		{[][2]int64{{1, 3}, {2, 5}}, 2},
+		{[][2]int64{{1, 9}, {4, 6}}, 0},
+		{[][2]int64{{4, 4}, {10, 20}}, 6},
+		{[][2]int64{{9, 8}}, 6},
+	}
+	for _, test := range tests {
+		if got := UnreadCount(items, test.read); got != test.expected {
+			t.Errorf("UnreadCount(%v) = %d, wanted %d", test.read, got, test.expected)
+		}
+	}
+}
+
+func TestLoadOverviewFmt(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST OVERVIEW.FMT",
+			"215 Order of fields\r\nFrom:\r\nSubject:\r\nDate:\r\nMessage-ID:\r\nReferences:\r\n:lines\r\n:bytes\r\n.\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\n.\r\n"},
+		exchange{"OVER 3", "224 overview\r\n3\tfred\ttest\ttoday\t<a@example.com>\t\t2\t100\r\n.\r\n"},
+	)
+	f, err := c.LoadOverviewFmt()
+	if err != nil {
+		t.Fatalf("Error loading format: %v", err)
+	}
+	if f.Index("From") != 0 {
+		t.Fatalf("Unexpected format %+v", f.Fields)
+	}
+	items, err := c.Over(3)
+	if err != nil {
+		t.Fatalf("Error getting overview: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Got %d items", len(items))
+	}
+	item := items[0]
+	if item.From != "fred" || item.Subject != "test" ||
+		item.Lines != 2 || item.Bytes != 100 {
+		t.Fatalf("Fields mapped wrongly: %+v", item)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"BODY 3", "222 3 <a@example.com>\r\nbody\r\n.\r\n"},
+		exchange{"DATE", "111 20261016120000\r\n"},
+	)
+	_, _, r, err := c.Body("3")
+	if err != nil {
+		t.Fatalf("Error getting body: %v", err)
+	}
+	// Ping must wait until the body has been read.
+	pinged := make(chan error)
+	go func() { pinged <- c.Ping() }()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("Error reading body: %v", err)
+	}
+	if err := <-pinged; err != nil {
+		t.Fatalf("Error pinging: %v", err)
+	}
+	// The scripted server has hung up now.
+	if err := c.Ping(); err == nil {
+		t.Fatalf("Expected an error pinging a closed connection")
+	}
+}
+
+func TestAuthMethods(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nAUTHINFO USER SASL\r\nSASL PLAIN EXTERNAL\r\n.\r\n"},
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nAUTHINFO SASL\r\nSASL PLAIN\r\n.\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nSASL PLAIN\r\n.\r\n"},
+	)
+	tests := []struct {
+		user bool
+		sasl string
+	}{
+		{true, "PLAIN EXTERNAL"},
+		{false, "PLAIN"},
+		{false, ""},
+	}
+	for _, test := range tests {
+		if _, err := c.Capabilities(); err != nil {
+			t.Fatalf("Error getting capabilities: %v", err)
+		}
+		user, sasl := c.AuthMethods()
+		if user != test.user || strings.Join(sasl, " ") != test.sasl {
+			t.Errorf("Got %v %q, wanted %v %q", user, sasl, test.user, test.sasl)
+		}
+	}
+}
+
+func TestArticleSize(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"OVER 3", "224 overview\r\n3\ttest\tfred\ttoday\t<a@example.com>\t\t1234\t20\r\n.\r\n"},
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"OVER 4", "224 overview\r\n4\ttest\tfred\ttoday\t<b@example.com>\t\r\n.\r\n"},
+	)
+	size, err := c.ArticleSize("misc.test", 3)
+	if err != nil || size != 1234 {
+		t.Fatalf("Got %d (%v), wanted 1234", size, err)
+	}
+	if _, err := c.ArticleSize("misc.test", 4); err == nil {
+		t.Fatalf("Expected an error without :bytes")
+	}
+}
+
+func TestFormatNNTPDate(t *testing.T) {
+	east := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		t    time.Time
+		date string
+		time string
+	}{
+		{time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), "19991231", "235959"},
+		{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), "20000101", "000000"},
+		// Converted to UTC, back across the year boundary.
+		{time.Date(2026, 1, 1, 1, 30, 0, 0, east), "20251231", "233000"},
+	}
+	for _, test := range tests {
+		date, timeStr := FormatNNTPDate(test.t)
+		if date != test.date || timeStr != test.time {
+			t.Errorf("Got %s %s for %v, wanted %s %s", date, timeStr, test.t, test.date, test.time)
+		}
+	}
+}
+
+func TestNewGroups(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"NEWGROUPS 20261016 120000 GMT",
+			"231 list of new newsgroups follows\r\nmisc.new 5 1 y\r\n.\r\n"},
+		exchange{"NEWNEWS misc.* 20261016 120000 GMT",
+			"230 list of new articles follows\r\n<a@example.com>\r\n.\r\n"},
+	)
+	since := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	groups, err := c.NewGroups(since)
+	if err != nil || len(groups) != 1 || groups[0].Name != "misc.new" {
+		t.Fatalf("Got %v (%v)", groups, err)
+	}
+	ids, err := c.NewNews("misc.*", since)
+	if err != nil || len(ids) != 1 || ids[0] != "<a@example.com>" {
+		t.Fatalf("Got %v (%v)", ids, err)
+	}
+}
+
+// newStalledClient returns a client connected to a server which answers
+// cmd with resp and then never responds again.
+func newStalledClient(t *testing.T, cmd, resp string) *Client {
+	t.Helper()
+	cconn, sconn := net.Pipe()
+	go func() {
+		s := textproto.NewConn(sconn)
+		s.PrintfLine("200 test server ready")
+		if line, err := s.ReadLine(); err != nil || line != cmd {
+			t.Errorf("Got %q (%v), wanted %s", line, err, cmd)
+			return
+		}
+		s.W.WriteString(resp)
+		s.W.Flush()
+		// Swallow anything sent, such as an article.
+		io.Copy(io.Discard, sconn)
+	}()
+	c, err := NewConn(cconn)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	t.Cleanup(func() { cconn.Close(); sconn.Close() })
+	return c
+}
+
+func TestPostTimeout(t *testing.T) {
+	tests := []struct {
+		resp  string
+		phase PostPhase
+	}{
+		{"", PostPrompt},
+		{"340 send article\r\n", PostResponse},
+	}
+	for _, test := range tests {
+		c := newStalledClient(t, "POST", test.resp)
+		c.PostTimeout = 50 * time.Millisecond
+		err := c.Post(strings.NewReader("Subject: test\r\n\r\nbody\r\n"))
+		te, ok := err.(*PostTimeoutError)
+		if !ok || te.Phase != test.phase || !te.Timeout() {
+			t.Fatalf("Got %v, wanted a timeout in the %s phase", err, test.phase)
+		}
+		if _, _, err := c.Command("DATE", 111); err != ErrConnectionBroken {
+			t.Errorf("Got %v after a timeout, wanted ErrConnectionBroken", err)
+		}
+	}
+}
+
+func TestDataCommand(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"XGTITLE misc.*", "282 list follows\r\nmisc.test A test group\r\n.\r\n"},
+		exchange{"XGTITLE alt.*", "282 list follows\r\na\r\nb\r\n.\r\n"},
+		exchange{"XGTITLE none.*", "481 no such groups\r\n"},
+	)
+	code, msg, lines, err := c.DataCommand("XGTITLE misc.*", 282)
+	if err != nil || code != 282 || msg != "list follows" ||
+		len(lines) != 1 || lines[0] != "misc.test A test group" {
+		t.Fatalf("Got %d %q %q (%v)", code, msg, lines, err)
+	}
+	c.MaxResponseLines = 1
+	if _, _, _, err := c.DataCommand("XGTITLE alt.*", 282); err == nil {
+		t.Fatalf("Response limits not applied")
+	}
+	if code, _, _, err := c.DataCommand("XGTITLE none.*", 282); err == nil || code != 481 {
+		t.Fatalf("Got %d (%v), wanted 481", code, err)
+	}
+}
+
+func TestFetchBestEffort(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"BODY 3", "222 3 <a@example.com>\r\nby number\r\n.\r\n"},
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"BODY 4", "423 no such article\r\n"},
+		exchange{"BODY <b@example.com>", "222 0 <b@example.com>\r\nby id\r\n.\r\n"},
+		exchange{"GROUP gone.test", "411 no such group\r\n"},
+		exchange{"BODY <c@example.com>", "430 no such article\r\n"},
+		exchange{"GROUP misc.test", "211 3 1 5 misc.test\r\n"},
+		exchange{"BODY 5", "423 no such article\r\n"},
+		exchange{"BODY <d@example.com>", "222 0 <d@example.com>\r\nunread\r\n.\r\n"},
+		exchange{"DATE", "111 20261016120000\r\n"},
+	)
+	for _, test := range []struct {
+		group string
+		num   int64
+		id    string
+		body  string
+	}{
+		{"misc.test", 3, "<a@example.com>", "by number\n"},
+		{"misc.test", 4, "<b@example.com>", "by id\n"},
+	} {
+		r, err := c.FetchBestEffort(test.group, test.num, test.id)
+		if err != nil {
+			t.Fatalf("Error fetching %s: %v", test.id, err)
+		}
+		body, _ := io.ReadAll(r)
+		r.Close()
+		if string(body) != test.body {
+			t.Errorf("Got %q for %s, wanted %q", body, test.id, test.body)
+		}
+	}
+
+	_, err := c.FetchBestEffort("gone.test", 1, "<c@example.com>")
+	if err == nil || !strings.Contains(err.Error(), "411") || !strings.Contains(err.Error(), "430") {
+		t.Fatalf("Got %v, wanted both failures", err)
+	}
+
+	// Closing without reading leaves the client usable.
+	r, err := c.FetchBestEffort("misc.test", 5, "<d@example.com>")
+	if err != nil {
+		t.Fatalf("Error fetching: %v", err)
+	}
+	r.Close()
+	if err := c.Ping(); err != nil {
+		t.Fatalf("Error after closing: %v", err)
+	}
+}
+
+func TestGroupsCreatedSince(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST ACTIVE.TIMES", "215 information follows\r\n" +
+			"misc.old 1000000000 fred@example.com\r\n" +
+			"misc.newer 1800000000 barney@example.com\r\n" +
+			"misc.new 1700000000 wilma@example.com\r\n" +
+			".\r\n"},
+	)
+	groups, err := c.GroupsCreatedSince(time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatalf("Error listing: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "misc.new" || groups[1].Name != "misc.newer" ||
+		groups[0].Creator != "wilma@example.com" {
+		t.Fatalf("Got %v", groups)
+	}
+}
+
+func TestStat(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"STAT 3", "223 3 <a@example.com>\r\n"},
+		exchange{"STAT <b@example.com>", "430 no such article\r\n"},
+		exchange{"STAT 5", "412 no newsgroup selected\r\n"},
+	)
+	n, id, err := c.Stat("3")
+	if err != nil || n != 3 || id != "<a@example.com>" {
+		t.Fatalf("Got %d %q (%v)", n, id, err)
+	}
+	_, _, err = c.Stat("<b@example.com>")
+	var te nntp.Error
+	if !errors.Is(err, ErrNoSuchArticle) || !errors.As(err, &te) || te.Code != 430 {
+		t.Fatalf("Got %v, wanted ErrNoSuchArticle", err)
+	}
+	if _, _, err = c.Stat("5"); err == nil || errors.Is(err, ErrNoSuchArticle) {
+		t.Fatalf("Got %v, wanted a 412 error", err)
+	}
+}
+
+func TestNextLast(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"NEXT", "223 4 <b@example.com>\r\n"},
+		exchange{"NEXT", "421 no next article\r\n"},
+		exchange{"LAST", "223 3 <a@example.com>\r\n"},
+		exchange{"LAST", "422 no previous article\r\n"},
+	)
+	if n, id, err := c.Next(); err != nil || n != 4 || id != "<b@example.com>" {
+		t.Fatalf("Got %d %q (%v)", n, id, err)
+	}
+	if _, _, err := c.Next(); !errors.Is(err, ErrNoNextArticle) {
+		t.Fatalf("Got %v, wanted ErrNoNextArticle", err)
+	}
+	if n, id, err := c.Last(); err != nil || n != 3 || id != "<a@example.com>" {
+		t.Fatalf("Got %d %q (%v)", n, id, err)
+	}
+	if _, _, err := c.Last(); !errors.Is(err, ErrNoPrevArticle) {
+		t.Fatalf("Got %v, wanted ErrNoPrevArticle", err)
+	}
+}
+
+func TestQuitClose(t *testing.T) {
+	c := newTestClient(t, exchange{"QUIT", "205 bye\r\n"})
+	if err := c.Quit(); err != nil {
+		t.Fatalf("Error quitting: %v", err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Fatalf("Error quitting again: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Error closing after quitting: %v", err)
+	}
+	if _, _, err := c.Command("DATE", 111); err != ErrClientClosed {
+		t.Fatalf("Got %v after quitting, wanted ErrClientClosed", err)
+	}
+
+	c = newTestClient(t)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Error closing: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Error closing again: %v", err)
+	}
+}
+
+func TestQuitUnanswered(t *testing.T) {
+	defer func(d time.Duration) { quitTimeout = d }(quitTimeout)
+	quitTimeout = 50 * time.Millisecond
+	cconn, sconn := net.Pipe()
+	t.Cleanup(func() { sconn.Close() })
+	go func() {
+		s := textproto.NewConn(sconn)
+		s.PrintfLine("200 test server ready")
+		// Never answer.
+		io.Copy(io.Discard, sconn)
+	}()
+	c, err := NewConn(cconn)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	if err := c.Quit(); err == nil {
+		t.Fatalf("Quit succeeded without a response")
+	}
+	if _, err := cconn.Write([]byte("x")); err == nil {
+		t.Fatalf("Connection still open")
+	}
+}
+
+func TestCloseDuringCall(t *testing.T) {
+	for _, quit := range []bool{false, true} {
+		c := newStalledClient(t, "GROUP misc.test", "")
+		errc := make(chan error, 1)
+		go func() {
+			_, err := c.Group("misc.test")
+			errc <- err
+		}()
+		// Let Group wait for the response.
+		time.Sleep(50 * time.Millisecond)
+		closed := make(chan error, 1)
+		go func() {
+			if quit {
+				closed <- c.Quit()
+			} else {
+				closed <- c.Close()
+			}
+		}()
+		select {
+		case err := <-closed:
+			if err != nil {
+				t.Fatalf("Error closing (quit %v): %v", quit, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Closing (quit %v) waited for the pending call", quit)
+		}
+		if err := <-errc; err == nil {
+			t.Fatalf("Group succeeded on a closed connection (quit %v)", quit)
+		}
+		if _, _, err := c.Command("DATE", 111); err != ErrClientClosed {
+			t.Fatalf("Got %v after closing, wanted ErrClientClosed", err)
+		}
+	}
+}
+
+func TestCloseUnreadArticle(t *testing.T) {
+	c := newStalledClient(t, "ARTICLE 1", "220 1 <a@example.com>\r\nSubject: test\r\n\r\n")
+	_, _, r, err := c.Article("1")
+	if err != nil {
+		t.Fatalf("Error getting the article: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error closing: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close waited for the article to be read")
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatalf("Read the article from a closed connection")
+	}
+	r.Close()
+}
+
+func TestVerifyPost(t *testing.T) {
+	defer func(d time.Duration) { verifyPostBackoff = d }(verifyPostBackoff)
+	verifyPostBackoff = 50 * time.Millisecond
+	c := newTestClient(t,
+		exchange{"STAT <a@example.com>", "430 no such article\r\n"},
+		exchange{"STAT <a@example.com>", "430 no such article\r\n"},
+		exchange{"STAT <a@example.com>", "223 0 <a@example.com>\r\n"},
+		exchange{"STAT <b@example.com>", "430 no such article\r\n"},
+		exchange{"STAT <b@example.com>", "430 no such article\r\n"},
+		exchange{"STAT <b@example.com>", "430 no such article\r\n"},
+		exchange{"STAT <c@example.com>", "480 authentication required\r\n"},
+	)
+	if ok, err := c.VerifyPost("<a@example.com>", time.Minute); !ok || err != nil {
+		t.Fatalf("Got %v (%v), wanted the article found", ok, err)
+	}
+	// Tried after 0, 50 and 120ms.
+	if ok, err := c.VerifyPost("<b@example.com>", 120*time.Millisecond); ok || err != nil {
+		t.Fatalf("Got %v (%v), wanted the article not found", ok, err)
+	}
+	if _, err := c.VerifyPost("<c@example.com>", time.Minute); err == nil {
+		t.Fatalf("Got no error for a 480 response")
+	}
+}
+
+func TestDate(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"DATE", "111 20261016120304\r\n"},
+		exchange{"DATE", "111 19991231235959 server time\r\n"},
+		exchange{"DATE", "111 2026101612\r\n"},
+		exchange{"DATE", "111 2026101612030x\r\n"},
+	)
+	for _, want := range []time.Time{
+		time.Date(2026, 10, 16, 12, 3, 4, 0, time.UTC),
+		time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC),
+	} {
+		got, err := c.Date()
+		if err != nil || !got.Equal(want) || got.Location() != time.UTC {
+			t.Fatalf("Got %v (%v), wanted %v", got, err, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Date(); err == nil {
+			t.Fatalf("Accepted an invalid timestamp")
+		}
+	}
+}
+
+func TestNewGroupsUTC(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"NEWGROUPS 20251231 230000 GMT", "231 list of new newsgroups follows\r\n.\r\n"},
+	)
+	west := time.FixedZone("UTC-5", -5*60*60)
+	groups, err := c.NewGroups(time.Date(2025, 12, 31, 18, 0, 0, 0, west))
+	if err != nil || groups == nil || len(groups) != 0 {
+		t.Fatalf("Got %#v (%v), wanted an empty list", groups, err)
+	}
+}
+
+func TestNewNewsEmpty(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"NEWNEWS comp.*,!comp.os.* 20261016 000000 GMT", "230 list of new articles follows\r\n.\r\n"},
+	)
+	ids, err := c.NewNews("comp.*,!comp.os.*", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+	if err != nil || ids == nil || len(ids) != 0 {
+		t.Fatalf("Got %#v (%v), wanted an empty list", ids, err)
+	}
+}
+
+func TestListGroup(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LISTGROUP misc.test", "211 3 1 5 misc.test list follows\r\n1\r\n3\r\n5\r\n.\r\n"},
+		exchange{"LISTGROUP misc.test 3", "211 3 1 5 misc.test\r\n3\r\n.\r\n"},
+		exchange{"LISTGROUP misc.test 2-4", "211 3 1 5\r\n3\r\n.\r\n"},
+	)
+	g, nums, err := c.ListGroup("misc.test")
+	if err != nil || g.Count != 3 || g.Low != 1 || g.High != 5 || g.Name != "misc.test" {
+		t.Fatalf("Got %v (%v)", g, err)
+	}
+	if len(nums) != 3 || nums[0] != 1 || nums[1] != 3 || nums[2] != 5 {
+		t.Fatalf("Got numbers %v", nums)
+	}
+	for _, rng := range [][]int{{3}, {2, 4}} {
+		g, nums, err := c.ListGroup("misc.test", rng...)
+		if err != nil || g.Name != "misc.test" || len(nums) != 1 || nums[0] != 3 {
+			t.Fatalf("Got %v %v (%v) for %v", g, nums, err, rng)
+		}
+	}
+	if _, _, err := c.ListGroup("misc.test", 1, 2, 3); err == nil {
+		t.Fatalf("Accepted three numbers")
+	}
+}
+
+func TestHdr(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nHDR\r\n.\r\n"},
+		exchange{"HDR Subject 1-2", "225 headers follow\r\n1 first\r\n2 \r\n.\r\n"},
+		exchange{"HDR Subject", "225 headers follow\r\n3 current\r\n.\r\n"},
+	)
+	lines, err := c.Hdr("Subject", "1-2")
+	if err != nil || len(lines) != 2 || lines[0] != "1 first" || lines[1] != "2 " {
+		t.Fatalf("Got %q (%v)", lines, err)
+	}
+	lines, err = c.Hdr("Subject", "")
+	if err != nil || len(lines) != 1 || lines[0] != "3 current" {
+		t.Fatalf("Got %q (%v)", lines, err)
+	}
+}
+
+func TestLegacyOverHdr(t *testing.T) {
+	over := "1\tsubject\tfrom\tdate\t<a@example.com>\t\t100\t5\r\n.\r\n"
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "500 What?\r\n"},
+		exchange{"XOVER 1-1", "224 overview follows\r\n" + over},
+		exchange{"XHDR Subject 1", "221 headers follow\r\n1 subject\r\n.\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\nREADER\r\n.\r\n"},
+		exchange{"OVER 1-1", "224 overview follows\r\n" + over},
+		exchange{"XHDR Subject 1", "221 headers follow\r\n1 subject\r\n.\r\n"},
+	)
+	for i := 0; i < 2; i++ {
+		items, err := c.Over(1, 1)
+		if err != nil || len(items) != 1 || items[0].Subject != "subject" {
+			t.Fatalf("Got %v (%v)", items, err)
+		}
+		lines, err := c.Hdr("Subject", "1")
+		if err != nil || len(lines) != 1 || lines[0] != "1 subject" {
+			t.Fatalf("Got %q (%v)", lines, err)
+		}
+		if i == 0 {
+			if _, err := c.Capabilities(); err != nil {
+				t.Fatalf("Error getting capabilities: %v", err)
+			}
+		}
+	}
+}
+
+func TestCommandNameCapabilitiesError(t *testing.T) {
+	over := "1\tsubject\tfrom\tdate\t<a@example.com>\t\t100\t5\r\n.\r\n"
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "480 authentication required\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\n.\r\n"},
+		exchange{"OVER 1-1", "224 overview follows\r\n" + over},
+	)
+	// Not taken for a server predating CAPABILITIES.
+	if _, err := c.Over(1, 1); err == nil {
+		t.Fatalf("Over succeeded without capabilities")
+	}
+	items, err := c.Over(1, 1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Got %v (%v)", items, err)
+	}
+}
+
+func TestOverItemMetadata(t *testing.T) {
+	fields := strings.Split("3\ts\tf\td\t<a@example.com>\t\t\t12", "\t")
+	item := parseOverItem(fields, nntp.DefaultOverviewFmt)
+	if item.Bytes != 0 || item.Lines != 12 {
+		t.Fatalf("Got %d bytes, %d lines, wanted 0 and 12", item.Bytes, item.Lines)
+	}
+}
+
+func TestOverShortLines(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\n.\r\n"},
+		exchange{"OVER 1-3", "224 overview\r\n" +
+			"1\ts\tf\td\t<a@example.com>\r\n" +
+			"2\r\n" +
+			"bogus\ts\r\n" +
+			"3\ts\tf\td\t<c@example.com>\t<a@example.com>\t100\r\n.\r\n"},
+	)
+	items, err := c.Over(1, 3)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("Got %v (%v)", items, err)
+	}
+	if items[0].Number != 1 || items[0].References != "" || items[0].Bytes != 0 {
+		t.Errorf("Unexpected first item %+v", items[0])
+	}
+	if items[1].Number != 2 || items[1].Subject != "" {
+		t.Errorf("Unexpected second item %+v", items[1])
+	}
+	if items[2].Number != 3 || items[2].References != "<a@example.com>" || items[2].Bytes != 100 || items[2].Lines != 0 {
+		t.Errorf("Unexpected third item %+v", items[2])
+	}
+}
+
+func TestOverMessageID(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER MSGID\r\n.\r\n"},
+		exchange{"OVER <a@example.com>", "224 overview\r\n" +
+			"0\ts\tf\td\t<a@example.com>\t\t100\t3\r\n.\r\n"},
+		exchange{"OVER <b@example.com>", "430 no such article\r\n"},
+	)
+	item, err := c.OverMessageID("<a@example.com>")
+	if err != nil || item.Number != 0 || item.MessageId != "<a@example.com>" || item.Lines != 3 {
+		t.Fatalf("Got %+v (%v)", item, err)
+	}
+	_, err = c.OverMessageID("<b@example.com>")
+	var ne nntp.Error
+	if !errors.Is(err, ErrNoSuchArticle) || !errors.As(err, &ne) || ne.Code != 430 {
+		t.Fatalf("Got %v, wanted ErrNoSuchArticle", err)
+	}
+
+	c = newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\n.\r\n"},
+	)
+	if _, err := c.OverMessageID("<a@example.com>"); err == nil {
+		t.Fatalf("OverMessageID succeeded without OVER MSGID")
+	}
+}
+
+func TestOverStructured(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST OVERVIEW.FMT", "215 Order of fields\r\n" +
+			"Subject:\r\nFrom:\r\nDate:\r\nMessage-ID:\r\nReferences:\r\n:bytes\r\n:lines\r\nXref:full\r\n.\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nOVER\r\n.\r\n"},
+		exchange{"OVER 1", "224 overview\r\n" +
+			"1\ts\tf\td\t<a@x>\t\t10\t1\tXref: example.com misc.test:1\r\n.\r\n"},
+		exchange{"OVER 2", "224 overview\r\n2\ts\tf\td\t<b@x>\t\t10\t1\t\r\n.\r\n"},
+	)
+	items, err := c.OverStructured(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Got %v (%v)", items, err)
+	}
+	if items[0].Extra["Xref"] != "example.com misc.test:1" || items[0].Lines != 1 {
+		t.Fatalf("Unexpected item %+v", items[0])
+	}
+	// The format is only retrieved once.
+	items, err = c.OverStructured(2)
+	if err != nil || len(items) != 1 || items[0].Extra["Xref"] != "" {
+		t.Fatalf("Got %+v (%v)", items, err)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"GROUP misc.test", "503 program fault\r\n"},
+	)
+	_, err := c.Group("misc.test")
+	var ne nntp.Error
+	if !errors.As(err, &ne) || ne.Code != 503 || ne.Msg != "program fault" {
+		t.Fatalf("Got %#v, wanted an nntp.Error", err)
+	}
+	// Transport errors stay as they are.
+	_, err = c.Group("misc.test")
+	if errors.As(err, &ne) {
+		t.Fatalf("Got an nntp.Error for a closed connection: %v", err)
+	}
+}
+
+func TestIHave(t *testing.T) {
+	article := "Message-ID: <a@example.com>\r\n\r\n.body\r\n"
+	c := newTestClient(t,
+		exchange{"IHAVE <a@example.com>", "335 send it\r\n"},
+		exchange{"Message-ID: <a@example.com>", ""},
+		exchange{"", ""},
+		exchange{"..body", ""},
+		exchange{".", "235 article transferred\r\n"},
+		exchange{"IHAVE <b@example.com>", "435 not wanted\r\n"},
+		exchange{"IHAVE <c@example.com>", "436 try later\r\n"},
+		exchange{"IHAVE <d@example.com>", "335 send it\r\n"},
+		exchange{"Message-ID: <a@example.com>", ""},
+		exchange{"", ""},
+		exchange{"..body", ""},
+		exchange{".", "437 rejected\r\n"},
+	)
+	if err := c.IHave("<a@example.com>", strings.NewReader(article)); err != nil {
+		t.Fatalf("Error transferring: %v", err)
+	}
+	for _, test := range []struct {
+		id   string
+		want error
+	}{
+		{"<b@example.com>", ErrIHaveNotWanted},
+		{"<c@example.com>", ErrIHaveDeferred},
+		{"<d@example.com>", ErrIHaveRejected},
+	} {
+		if err := c.IHave(test.id, strings.NewReader(article)); !errors.Is(err, test.want) {
+			t.Errorf("Got %v for %s, wanted %v", err, test.id, test.want)
+		}
+	}
+}
+
+// The accessors lock the client, so that they may be called while
+// another goroutine retrieves the capabilities (checked by -race).
+func TestCapabilityAccessorsConcurrent(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nREADER\r\n.\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nREADER\r\nAUTHINFO USER\r\n.\r\n"},
+	)
+	if _, err := c.Capabilities(); err != nil {
+		t.Fatalf("Error getting capabilities: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := c.Capabilities()
+		done <- err
+	}()
+	for i := 0; i < 100; i++ {
+		c.GetCapability("READER")
+		c.HasCapabilityArgument("AUTHINFO", "USER")
+		c.AuthMethods()
+		c.MaxPostSize()
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Error getting capabilities again: %v", err)
+	}
+	if user, _ := c.AuthMethods(); !user {
+		t.Errorf("AUTHINFO USER not found after refreshing capabilities")
+	}
+}
+
+func TestModeReader(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"MODE READER", "201 Posting prohibited\r\n"},
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nREADER\r\n.\r\n"},
+		exchange{"authinfo user fred", "381 more\r\n"},
+		exchange{"authinfo pass secret", "281 ok\r\n"},
+		exchange{"MODE READER", "200 Posting allowed\r\n"},
+		exchange{"CAPABILITIES", "503 nope\r\n"},
+		exchange{"MODE READER", "502 Transit service only\r\n"},
+	)
+	status, err := c.ModeReader()
+	if err != nil || status != nntp.PostingNotPermitted {
+		t.Fatalf("Got %v, %v, wanted posting not permitted", status, err)
+	}
+	if c.GetCapability("READER") != "READER" {
+		t.Errorf("Capabilities not refreshed: %v", c.capabilities)
+	}
+	if err := c.Post(strings.NewReader("Subject: test\n\nbody\n")); err != ErrPostingNotAllowed {
+		t.Errorf("Got %v posting, wanted %v", err, ErrPostingNotAllowed)
+	}
+	if _, err := c.Authenticate("fred", "secret"); err != nil {
+		t.Fatalf("Error authenticating: %v", err)
+	}
+	if !c.PostingAllowed {
+		t.Errorf("Posting not allowed after authentication")
+	}
+	status, err = c.ModeReader()
+	if err != nil || status != nntp.PostingPermitted {
+		t.Fatalf("Got %v, %v, wanted posting permitted", status, err)
+	}
+	if c.capabilities != nil {
+		t.Errorf("Got capabilities %v from a server without CAPABILITIES", c.capabilities)
+	}
+	var ne nntp.Error
+	if _, err := c.ModeReader(); !errors.As(err, &ne) || ne.Code != 502 {
+		t.Errorf("Got %v, wanted a 502 error", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"authinfo user fred", "381 more\r\n"},
+		exchange{"authinfo pass secret", "281 ok\r\n"},
+		exchange{"authinfo user fred", "281 no password needed\r\n"},
+		exchange{"authinfo pass secret", "281 ok\r\n"},
+		exchange{"authinfo user fred", "481 go away\r\n"},
+		exchange{"authinfo user fred", "381 more\r\n"},
+		exchange{"authinfo pass wrong", "481 go away\r\n"},
+	)
+	for _, test := range []struct {
+		user, pass string
+		msg        string
+	}{
+		{"fred", "secret", "ok"},
+		{"fred", "secret", "no password needed"},
+		{"", "secret", "ok"},
+	} {
+		msg, err := c.Authenticate(test.user, test.pass)
+		if err != nil || msg != test.msg {
+			t.Errorf("Got %q, %v, wanted %q", msg, err, test.msg)
+		}
+	}
+	for _, pass := range []string{"secret", "wrong"} {
+		_, err := c.Authenticate("fred", pass)
+		if e, ok := err.(nntp.Error); !ok || e.Code != 481 {
+			t.Errorf("Got %v, wanted a 481 error", err)
+		}
+	}
+}
+
+func TestArticleParsed(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"ARTICLE 1", "220 1 <a@example.com>\r\n" +
+			"Subject: test\r\nFrom: fred@example.com\r\n\r\n..line one\r\n\r\nline three\r\n.\r\n"},
+		exchange{"DATE", "111 20240102030405\r\n"},
+	)
+	n, a, err := c.ArticleParsed("1")
+	if err != nil || n != 1 {
+		t.Fatalf("Got %d (%v)", n, err)
+	}
+	if a.Header.Get("Subject") != "test" || a.Header.Get("From") != "fred@example.com" {
+		t.Errorf("Got headers %v", a.Header)
+	}
+	body, err := io.ReadAll(a.Body)
+	if err != nil || string(body) != ".line one\n\nline three\n" {
+		t.Errorf("Got body %q (%v)", body, err)
+	}
+	// The connection is left in sync.
+	if _, err := c.Date(); err != nil {
+		t.Errorf("Error after reading the article: %v", err)
+	}
+}
+
+func TestBodyClose(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"BODY 1", "222 1 <a@example.com>\r\nline one\r\nline two\r\n.\r\n"},
+		exchange{"DATE", "111 20240102030405\r\n"},
+	)
+	_, _, r, err := c.Body("1")
+	if err != nil {
+		t.Fatalf("Error getting body: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "line" {
+		t.Fatalf("Got %q (%v)", buf, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing the body: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Error closing the body again: %v", err)
+	}
+	if _, err := c.Date(); err != nil {
+		t.Errorf("Error after closing the body: %v", err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST ACTIVE", "215 list follows\r\nmisc.test 4 1 y\r\nbogus\r\n.\r\n"},
+	)
+	var buf bytes.Buffer
+	c.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	groups, err := c.List("ACTIVE")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("Got %v (%v)", groups, err)
+	}
+	if got := buf.String(); !strings.Contains(got, `msg="skipping malformed group line" line=bogus`) {
+		t.Errorf("Got log %q", got)
+	}
+}
+
+func TestListCounts(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nLIST ACTIVE COUNTS\r\n.\r\n"},
+		exchange{"LIST COUNTS misc.*", "215 list follows\r\n" +
+			"misc.test 5 1 4 y\r\n" +
+			"misc.short 5 1 4\r\n" +
+			"misc.bogus 5 1 many y\r\n" +
+			"misc.mod 30 20 0 m\r\n.\r\n"},
+	)
+	groups, err := c.ListCounts("misc.*")
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("Got %v (%v)", groups, err)
+	}
+	g := groups[0]
+	if g.Name != "misc.test" || g.High != 5 || g.Low != 1 || g.Count != 4 || g.Posting != nntp.PostingPermitted {
+		t.Errorf("Unexpected first group %#v", g)
+	}
+	if g := groups[1]; g.Name != "misc.mod" || g.Count != 0 || g.Posting != nntp.PostingModerated {
+		t.Errorf("Unexpected second group %#v", g)
+	}
+}
+
+func TestListCountsUnsupported(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nLIST ACTIVE\r\n.\r\n"},
+	)
+	if _, err := c.ListCounts(""); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("Got %v, wanted an unsupported error", err)
+	}
+}
+
+func TestListActiveTimes(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST ACTIVE.TIMES misc.*", "215 list follows\r\n" +
+			"misc.test 1700000000 fred@example.com\r\n" +
+			"misc.misc 1600000000 Fred Bloggs <fred@example.com>\r\n" +
+			"misc.bogus yesterday fred\r\n.\r\n"},
+	)
+	times, err := c.ListActiveTimes("misc.*")
+	if err != nil {
+		t.Fatalf("Error listing: %v", err)
+	}
+	want := map[string]nntp.GroupTime{
+		"misc.test": {Name: "misc.test", Created: time.Unix(1700000000, 0).UTC(),
+			Creator: "fred@example.com"},
+		"misc.misc": {Name: "misc.misc", Created: time.Unix(1600000000, 0).UTC(),
+			Creator: "Fred Bloggs <fred@example.com>"},
+	}
+	if len(times) != len(want) {
+		t.Fatalf("Got %v, wanted %v", times, want)
+	}
+	for name, gt := range want {
+		if times[name] != gt {
+			t.Errorf("Got %v for %s, wanted %v", times[name], name, gt)
+		}
+	}
+}
+
+func TestListMissingPostingStatus(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"LIST ACTIVE", "215 list follows\r\nmisc.test 4 1 y\r\nmisc.empty 0 1\r\n.\r\n"},
+	)
+	groups, err := c.List("ACTIVE")
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("Got %v (%v)", groups, err)
+	}
+	want := nntp.Group{Name: "misc.empty", High: 0, Low: 1, Posting: nntp.PostingNotPermitted}
+	if groups[1] != want {
+		t.Errorf("Got %#v, wanted %#v", groups[1], want)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"HELP", "100 Help text follows\r\nCommands:\r\n  ARTICLE [message-id|number]\r\n..\r\n.\r\n"},
+	)
+	lines, err := c.Help()
+	want := []string{"Commands:", "  ARTICLE [message-id|number]", "."}
+	if err != nil || strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Got %q (%v), wanted %q", lines, err, want)
+	}
+}
+
+func TestSlave(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"SLAVE", "202 slave status noted\r\n"},
+		exchange{"SLAVE", "500 unknown command\r\n"},
+	)
+	if err := c.Slave(); err != nil {
+		t.Fatalf("Error sending SLAVE: %v", err)
+	}
+	if err := c.Slave(); err == nil {
+		t.Fatalf("Expected an error from a server without SLAVE")
+	}
+}
+
+func TestNetConn(t *testing.T) {
+	c := newTestClient(t)
+	if c.NetConn() == nil {
+		t.Errorf("No connection for a client made with a net.Conn")
+	}
+	if _, ok := c.ConnectionState(); ok {
+		t.Errorf("Got a TLS state without TLS")
+	}
+}
+
+func TestNewTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	// The server never sends its banner.
+	go func() {
+		sconn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		io.Copy(io.Discard, sconn)
+	}()
+	_, err = NewTimeout("tcp", l.Addr().String(), 50*time.Millisecond)
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Got %v, wanted a timeout", err)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/textproto"
+)
+
+// Status lines of responses with a compressed data block end with this.
+const xfeatureGzipMarker = "[COMPRESS=GZIP]"
+
+// XFeatureCompressGzip enables the XFEATURE COMPRESS GZIP extension
+// offered by some commercial providers.
+//
+// This is not RFC 8054 compression: commands and status lines stay
+// uncompressed, and only the data blocks of responses whose status line
+// ends in "[COMPRESS=GZIP]" (typically XOVER and XHDR) are sent as a
+// compressed stream. Despite the name, many servers send zlib rather
+// than gzip streams, so both are accepted.
+//
+// The server has to advertise GZIP in its XFEATURE-COMPRESS capability;
+// capabilities are retrieved first if necessary.
+func (c *Client) XFeatureCompressGzip() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capabilities == nil {
+		if _, err := c.fetchCapabilities(); err != nil {
+			return err
+		}
+	}
+	ok, err := c.hasCapabilityArgument("XFEATURE-COMPRESS", "GZIP")
+	if err != nil || !ok {
+		return errors.New("XFEATURE COMPRESS GZIP not supported by server")
+	}
+	_, _, err = c.command("XFEATURE COMPRESS GZIP", 290)
+	if err != nil {
+		return err
+	}
+	c.xfeatureGzip = true
+	return nil
+}
+
+// readGzipBlock reads a data block sent as a gzip or zlib stream.
+func (c *Client) readGzipBlock() ([]string, error) {
+	magic, err := c.conn.R.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	// The decompressors read c.conn.R byte-wise, so they don't consume
+	// anything past the end of the compressed stream.
+	var zr io.ReadCloser
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(c.conn.R)
+		if err == nil {
+			gz.Multistream(false)
+			zr = gz
+		}
+	} else {
+		zr, err = zlib.NewReader(c.conn.R)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	lines, err := readDotBlock(textproto.NewReader(br), c.MaxResponseBytes, c.MaxResponseLines)
+	if _, tooLarge := err.(*ResponseTooLargeError); err != nil && !tooLarge {
+		return nil, err
+	}
+	// Consume the stream trailer.
+	if _, cerr := io.Copy(io.Discard, br); cerr != nil {
+		return nil, cerr
+	}
+	return lines, err
+}
+
+// Compress enables RFC 8054 compression with COMPRESS DEFLATE: from then
+// on, everything sent either way is compressed. The server has to
+// advertise DEFLATE in its COMPRESS capability; capabilities are
+// retrieved first if necessary.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8054
+func (c *Client) Compress() error {
+	return c.CompressContext(context.Background())
+}
+
+// CompressContext is like Compress, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) CompressContext(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.withContext(ctx, func() error {
+		if c.compressed {
+			return errors.New("compression already active")
+		}
+		if c.capabilities == nil {
+			if _, err := c.fetchCapabilities(); err != nil {
+				return err
+			}
+		}
+		ok, err := c.hasCapabilityArgument("COMPRESS", "DEFLATE")
+		if err != nil || !ok {
+			return errors.New("COMPRESS DEFLATE not supported by server")
+		}
+		return c.compress()
+	})
+}
+
+func (c *Client) compress() error {
+	if _, _, err := c.command("COMPRESS DEFLATE", 206); err != nil {
+		return err
+	}
+	// flate reads c.conn.R byte-wise, so nothing it has buffered is
+	// lost.
+	zw, _ := flate.NewWriter(c.conn.W, flate.DefaultCompression)
+	c.conn = textproto.NewConn(&deflateConn{
+		r:  flate.NewReader(c.conn.R),
+		zw: zw,
+		w:  c.conn.W,
+		c:  c.conn,
+	})
+	c.compressed = true
+	return nil
+}
+
+// deflateConn compresses a connection with raw deflate streams, as
+// required by RFC 8054.
+type deflateConn struct {
+	r  io.Reader
+	zw *flate.Writer
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+func (d *deflateConn) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Write compresses p and flushes it to the connection, as it's written
+// once a command is complete.
+func (d *deflateConn) Write(p []byte) (int, error) {
+	n, err := d.zw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := d.zw.Flush(); err != nil {
+		return n, err
+	}
+	return n, d.w.Flush()
+}
+
+func (d *deflateConn) Close() error {
+	return d.c.Close()
+}
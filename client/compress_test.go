@@ -0,0 +1,108 @@
+package nntpclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+func compressed(t *testing.T, useGzip bool, s string) string {
+	var buf bytes.Buffer
+	var w io.WriteCloser = zlib.NewWriter(&buf)
+	if useGzip {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func TestXFeatureCompressGzip(t *testing.T) {
+	over := "1\tsubject\tfrom\tdate\t<a@example.com>\t\t100\t5\r\n.\r\n"
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nOVER\r\nXFEATURE-COMPRESS GZIP TERMINATOR\r\n.\r\n"},
+		exchange{"XFEATURE COMPRESS GZIP", "290 feature enabled\r\n"},
+		exchange{"OVER 1-1", "224 overview follows [COMPRESS=GZIP]\r\n" + compressed(t, false, over)},
+		exchange{"OVER 1-1", "224 overview follows [COMPRESS=GZIP]\r\n" + compressed(t, true, over)},
+		exchange{"OVER 1-1", "224 overview follows\r\n" + over},
+	)
+	if err := c.XFeatureCompressGzip(); err != nil {
+		t.Fatalf("Error enabling compression: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		items, err := c.Over(1, 1)
+		if err != nil {
+			t.Fatalf("Error getting overview %d: %v", i, err)
+		}
+		if len(items) != 1 || items[0].MessageId != "<a@example.com>" {
+			t.Fatalf("Unexpected overview %d: %#v", i, items)
+		}
+	}
+}
+
+func TestXFeatureCompressGzipUnsupported(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\n.\r\n"},
+	)
+	if err := c.XFeatureCompressGzip(); err == nil {
+		t.Fatalf("Expected an error enabling unadvertised compression")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	defer cconn.Close()
+	go func() {
+		defer sconn.Close()
+		s := textproto.NewConn(sconn)
+		s.PrintfLine("200 test server ready")
+		s.ReadLine()
+		s.PrintfLine("101 Capability list:\r\nVERSION 2\r\nCOMPRESS DEFLATE\r\n.")
+		if line, _ := s.ReadLine(); line != "COMPRESS DEFLATE" {
+			t.Errorf("Got %q, wanted COMPRESS DEFLATE", line)
+			return
+		}
+		s.PrintfLine("206 Compression active")
+		zw, _ := flate.NewWriter(s.W, flate.BestSpeed)
+		zs := textproto.NewConn(&deflateConn{r: flate.NewReader(s.R), zw: zw, w: s.W, c: sconn})
+		for i := 0; i < 2; i++ {
+			if line, err := zs.ReadLine(); err != nil || line != "DATE" {
+				t.Errorf("Got %q (%v), wanted DATE", line, err)
+				return
+			}
+			zs.PrintfLine("111 20240102030405")
+		}
+	}()
+	c, err := NewConn(cconn)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	if err := c.Compress(); err != nil {
+		t.Fatalf("Error enabling compression: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Date(); err != nil {
+			t.Fatalf("Error with compression: %v", err)
+		}
+	}
+	if err := c.Compress(); err == nil {
+		t.Errorf("Compression enabled twice")
+	}
+}
+
+func TestCompressUnsupported(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES", "101 Capability list:\r\nVERSION 2\r\nCOMPRESS GZIP\r\n.\r\n"},
+	)
+	if err := c.Compress(); err == nil {
+		t.Fatalf("Expected an error enabling unadvertised compression")
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// deadlines holds the deadlines that apply to the connection, the
+// earliest of which is set on it.
+type deadlines struct {
+	mu sync.Mutex
+	// Set by the caller.
+	read, write time.Time
+	// Of the context of the current call.
+	ctx      time.Time
+	canceled bool
+	// Of the current phase of Post.
+	post time.Time
+}
+
+// updateDeadline changes the deadlines with f, and sets the resulting
+// deadline on the connection.
+func (c *Client) updateDeadline(f func(d *deadlines)) error {
+	c.deadlines.mu.Lock()
+	defer c.deadlines.mu.Unlock()
+	if c.netconn == nil {
+		return errors.New("deadlines not supported by the connection")
+	}
+	f(&c.deadlines)
+	d := &c.deadlines
+	read := earliest(d.read, d.ctx, d.post)
+	write := earliest(d.write, d.ctx, d.post)
+	if d.canceled {
+		// Any time in the past aborts pending reads and writes.
+		read = time.Unix(1, 0)
+		write = read
+	}
+	if err := c.netconn.SetReadDeadline(read); err != nil {
+		return err
+	}
+	return c.netconn.SetWriteDeadline(write)
+}
+
+// SetDeadline sets the read and write deadlines of the connection, like
+// net.Conn's SetDeadline: exchanges with the server fail once it's
+// passed, leaving the connection in an unknown state. It may be called
+// while another call is waiting for the server. The zero time means no
+// deadline.
+//
+// Deadlines are only supported on net.Conn connections. Contexts and
+// PostTimeout can only make the deadline earlier.
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.updateDeadline(func(d *deadlines) {
+		d.read = t
+		d.write = t
+	})
+}
+
+// SetReadDeadline sets the deadline for reading from the connection; see
+// SetDeadline.
+func (c *Client) SetReadDeadline(t time.Time) error {
+	return c.updateDeadline(func(d *deadlines) { d.read = t })
+}
+
+// SetWriteDeadline sets the deadline for writing to the connection; see
+// SetDeadline.
+func (c *Client) SetWriteDeadline(t time.Time) error {
+	return c.updateDeadline(func(d *deadlines) { d.write = t })
+}
+
+// earliest returns the earliest of the non-zero times, or the zero time
+// if there are none.
+func earliest(times ...time.Time) time.Time {
+	var e time.Time
+	for _, t := range times {
+		if !t.IsZero() && (e.IsZero() || t.Before(e)) {
+			e = t
+		}
+	}
+	return e
+}
+
+// watchContext makes ctx bound the exchanges with the server until stop
+// is called: its deadline is set on the connection, and pending reads
+// and writes are aborted once it's canceled. c.mu is held by the
+// caller until stop is called.
+//
+// stop returns the error of the exchanges, or the context's error if
+// they were cut short by it, in which case the connection is left
+// broken. This only works on net.Conn connections; ctx is ignored
+// otherwise, except for returning its error if it's already done.
+func (c *Client) watchContext(ctx context.Context) (stop func(error) error, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil || c.netconn == nil {
+		return func(err error) error { return err }, nil
+	}
+	deadline, _ := ctx.Deadline()
+	c.updateDeadline(func(d *deadlines) { d.ctx = deadline })
+	stopped := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			c.updateDeadline(func(d *deadlines) { d.canceled = true })
+		case <-stopped:
+		}
+	}()
+	return func(err error) error {
+		close(stopped)
+		<-exited
+		c.updateDeadline(func(d *deadlines) {
+			d.ctx = time.Time{}
+			d.canceled = false
+		})
+		var ne net.Error
+		if !errors.As(err, &ne) || !ne.Timeout() {
+			return err
+		}
+		if ctx.Err() != nil {
+			c.broken = true
+			return ctx.Err()
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			// The connection's deadline passed just before the
+			// context's.
+			c.broken = true
+			return context.DeadlineExceeded
+		}
+		return err
+	}, nil
+}
+
+// withContext calls f with ctx bounding its exchanges with the server,
+// as watchContext does. c.mu is held by the caller.
+func (c *Client) withContext(ctx context.Context, f func() error) (err error) {
+	stop, err := c.watchContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = stop(err) }()
+	return f()
+}
@@ -0,0 +1,110 @@
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestContextDeadline(t *testing.T) {
+	c := newStalledClient(t, "GROUP misc.test", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GroupContext(ctx, "misc.test"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Got %v, wanted context.DeadlineExceeded", err)
+	}
+	if _, _, err := c.Command("DATE", 111); err != ErrConnectionBroken {
+		t.Errorf("Got %v after a timeout, wanted ErrConnectionBroken", err)
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		call func(ctx context.Context, c *Client) error
+	}{
+		{"LIST ACTIVE", func(ctx context.Context, c *Client) error {
+			_, err := c.ListContext(ctx, "ACTIVE")
+			return err
+		}},
+		{"LISTGROUP misc.test", func(ctx context.Context, c *Client) error {
+			_, _, err := c.ListGroupContext(ctx, "misc.test")
+			return err
+		}},
+		{"NEXT", func(ctx context.Context, c *Client) error {
+			_, _, err := c.NextContext(ctx)
+			return err
+		}},
+		{"DATE", func(ctx context.Context, c *Client) error {
+			_, err := c.DateContext(ctx)
+			return err
+		}},
+		{"authinfo user user", func(ctx context.Context, c *Client) error {
+			_, err := c.AuthenticateContext(ctx, "user", "pass")
+			return err
+		}},
+		{"CHECK <a@example.com>", func(ctx context.Context, c *Client) error {
+			_, err := c.CheckContext(ctx, "<a@example.com>")
+			return err
+		}},
+	}
+	for _, test := range tests {
+		c := newStalledClient(t, test.cmd, "")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := test.call(ctx, c); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: got %v, wanted context.DeadlineExceeded", test.cmd, err)
+		}
+		cancel()
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	// The server stalls in the middle of the article.
+	c := newStalledClient(t, "ARTICLE 1", "220 1 <a@example.com>\r\nSubject: test\r\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	_, _, r, err := c.ArticleContext(ctx, "1")
+	if err != nil {
+		t.Fatalf("Error getting article: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Got %v, wanted context.Canceled", err)
+	}
+	if _, _, err := c.Command("DATE", 111); err != ErrConnectionBroken {
+		t.Errorf("Got %v after cancellation, wanted ErrConnectionBroken", err)
+	}
+}
+
+func TestContextDone(t *testing.T) {
+	// Nothing is sent with a context that is already done.
+	c := newTestClient(t, exchange{"DATE", "111 20240102030405\r\n"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.CommandContext(ctx, "DATE", 111); err != context.Canceled {
+		t.Fatalf("Got %v, wanted context.Canceled", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, msg, err := c.CommandContext(ctx, "DATE", 111); err != nil || msg != "20240102030405" {
+		t.Fatalf("Got %q (%v)", msg, err)
+	}
+}
+
+func TestSetDeadline(t *testing.T) {
+	c := newStalledClient(t, "GROUP misc.test", "")
+	// Set while the client waits for the server.
+	time.AfterFunc(50*time.Millisecond, func() { c.SetReadDeadline(time.Now()) })
+	var ne net.Error
+	if _, err := c.Group("misc.test"); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Got %v, wanted a timeout", err)
+	}
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		t.Errorf("Error clearing the deadline: %v", err)
+	}
+	if err := (&Client{}).SetDeadline(time.Now()); err == nil {
+		t.Errorf("Deadline set without a net.Conn")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// PipelineWindow is the number of commands a Pipeline keeps outstanding.
+const PipelineWindow = 16
+
+// A Pipeline sends a batch of article commands without waiting for each
+// response, saving a round trip per command. Commands are queued with
+// Stat, Head and Body, and sent by Exec.
+type Pipeline struct {
+	c    *Client
+	cmds []pipelineCmd
+}
+
+type pipelineCmd struct {
+	cmd       string
+	expect    int
+	specifier string
+}
+
+// A PipelineResult is the response to a pipelined command.
+type PipelineResult struct {
+	// The specifier the command was queued with.
+	Specifier string
+	Number    int64
+	MessageID string
+	// The headers or body, for HEAD and BODY.
+	Lines []string
+	// The command's error, e.g. ErrNoSuchArticle.
+	Err error
+}
+
+// Pipeline returns a new, empty pipeline of commands.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Stat queues a STAT command.
+func (p *Pipeline) Stat(specifier string) {
+	p.cmds = append(p.cmds, pipelineCmd{"STAT", 223, specifier})
+}
+
+// Head queues a HEAD command.
+func (p *Pipeline) Head(specifier string) {
+	p.cmds = append(p.cmds, pipelineCmd{"HEAD", 221, specifier})
+}
+
+// Body queues a BODY command.
+func (p *Pipeline) Body(specifier string) {
+	p.cmds = append(p.cmds, pipelineCmd{"BODY", 222, specifier})
+}
+
+// Exec sends the queued commands, keeping up to PipelineWindow of them
+// outstanding, and returns their results in order. The data blocks are
+// subject to the client's response limits. The client isn't available
+// to other calls in the meantime.
+//
+// The returned error is set if the exchange with the server failed, in
+// which case the connection is left in an unknown state; errors of
+// single commands are reported in their results. The queue is emptied
+// either way.
+func (p *Pipeline) Exec() ([]PipelineResult, error) {
+	c := p.c
+	cmds := p.cmds
+	p.cmds = nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make([]PipelineResult, 0, len(cmds))
+	sent := 0
+	for len(results) < len(cmds) {
+		for sent < len(cmds) && sent-len(results) < PipelineWindow {
+			cmd := cmds[sent]
+			if err := c.send("%s %s", cmd.cmd, cmd.specifier); err != nil {
+				if sent > len(results) {
+					// Responses are left unread.
+					c.broken = true
+				}
+				return results, err
+			}
+			sent++
+		}
+		cmd := cmds[len(results)]
+		result, err := c.pipelineResult(cmd)
+		if err != nil {
+			c.broken = true
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// pipelineResult reads the response to a pipelined command.
+func (c *Client) pipelineResult(cmd pipelineCmd) (PipelineResult, error) {
+	result := PipelineResult{Specifier: cmd.specifier}
+	_, msg, err := c.readCodeLine(cmd.expect)
+	if e, ok := err.(nntp.Error); ok {
+		if e.Code == 423 || e.Code == 430 {
+			result.Err = fmt.Errorf("%w: %w", ErrNoSuchArticle, err)
+		} else {
+			result.Err = err
+		}
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	fields := strings.Fields(msg)
+	if len(fields) >= 2 {
+		result.Number, _ = strconv.ParseInt(fields[0], 10, 64)
+		result.MessageID = fields[1]
+	}
+	if cmd.cmd == "STAT" {
+		return result, nil
+	}
+	result.Lines, err = c.readBlock(msg)
+	if _, tooLarge := err.(*ResponseTooLargeError); tooLarge {
+		result.Err = err
+		err = nil
+	}
+	return result, err
+}
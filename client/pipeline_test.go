@@ -0,0 +1,58 @@
+package nntpclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	script := []exchange{
+		{"STAT 1", "223 1 <1@example.com>\r\n"},
+		{"HEAD 2", "221 2 <2@example.com>\r\nSubject: two\r\n.\r\n"},
+		{"BODY <3@example.com>", "222 3 <3@example.com>\r\n..dotted\r\n.\r\n"},
+		{"STAT 4", "423 no such article\r\n"},
+	}
+	// Enough commands to fill the window.
+	for i := 5; i < 5+PipelineWindow; i++ {
+		script = append(script, exchange{fmt.Sprintf("STAT %d", i),
+			fmt.Sprintf("223 %d <%d@example.com>\r\n", i, i)})
+	}
+	script = append(script, exchange{"DATE", "111 20240102030405\r\n"})
+	c := newTestClient(t, script...)
+
+	p := c.Pipeline()
+	p.Stat("1")
+	p.Head("2")
+	p.Body("<3@example.com>")
+	p.Stat("4")
+	for i := 5; i < 5+PipelineWindow; i++ {
+		p.Stat(fmt.Sprint(i))
+	}
+	results, err := p.Exec()
+	if err != nil {
+		t.Fatalf("Error executing pipeline: %v", err)
+	}
+	if len(results) != 4+PipelineWindow {
+		t.Fatalf("Got %d results", len(results))
+	}
+	if r := results[0]; r.Number != 1 || r.MessageID != "<1@example.com>" || r.Err != nil {
+		t.Errorf("Got %#v for STAT", r)
+	}
+	if r := results[1]; r.Number != 2 || strings.Join(r.Lines, "|") != "Subject: two" || r.Err != nil {
+		t.Errorf("Got %#v for HEAD", r)
+	}
+	if r := results[2]; r.Specifier != "<3@example.com>" || strings.Join(r.Lines, "|") != ".dotted" {
+		t.Errorf("Got %#v for BODY", r)
+	}
+	if r := results[3]; !errors.Is(r.Err, ErrNoSuchArticle) {
+		t.Errorf("Got %#v for a missing article", r)
+	}
+	if r := results[len(results)-1]; r.Number != int64(4+PipelineWindow) {
+		t.Errorf("Got %#v for the last STAT", r)
+	}
+	if _, err := c.Date(); err != nil {
+		t.Errorf("Error after the pipeline: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Get once the pool is closed.
+var ErrPoolClosed = errors.New("pool closed")
+
+// A Pool keeps up to a fixed number of clients connected, such as the
+// number of connections a provider allows per account, and hands them
+// out to concurrent users.
+type Pool struct {
+	dial func() (*Client, error)
+	// Holds a token for every connected client.
+	slots chan struct{}
+	idle  chan *Client
+	// Closed by Close, to wake up waiting calls to Get.
+	done chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	// The clients handed out by Get and not put back yet.
+	inUse map[*Client]bool
+}
+
+// NewPool returns a pool of up to size clients, connected (and
+// authenticated, etc.) by dial when needed.
+func NewPool(size int, dial func() (*Client, error)) *Pool {
+	return &Pool{
+		dial:  dial,
+		slots: make(chan struct{}, size),
+		idle:  make(chan *Client, size),
+		done:  make(chan struct{}),
+		inUse: map[*Client]bool{},
+	}
+}
+
+// Get returns an idle client, or a new one if the pool isn't full,
+// waiting for a client to be put back otherwise. Idle clients are
+// checked with a DATE command first, and discarded if they fail it.
+//
+// The client has to be put back with Put once done. Get fails with
+// ErrPoolClosed once the pool is closed, even while waiting.
+func (p *Pool) Get(ctx context.Context) (*Client, error) {
+	for {
+		if p.isClosed() {
+			return nil, ErrPoolClosed
+		}
+		var c *Client
+		select {
+		case c = <-p.idle:
+		default:
+			select {
+			case c = <-p.idle:
+			case p.slots <- struct{}{}:
+				// Close may have been called meanwhile.
+				if p.isClosed() {
+					<-p.slots
+					return nil, ErrPoolClosed
+				}
+				c, err := p.dial()
+				if err != nil {
+					<-p.slots
+					return nil, err
+				}
+				p.handOut(c)
+				return c, nil
+			case <-p.done:
+				return nil, ErrPoolClosed
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if _, _, err := c.CommandContext(ctx, "DATE", 111); err != nil {
+			p.discard(c)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		p.handOut(c)
+		return c, nil
+	}
+}
+
+func (p *Pool) handOut(c *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse[c] = true
+}
+
+// Put puts a client back into the pool. Clients whose connection is
+// broken or closed are discarded. Putting back a client which isn't in
+// use, e.g. a second time, does nothing.
+func (p *Pool) Put(c *Client) {
+	c.mu.Lock()
+	dead := c.broken || c.closed.Load()
+	c.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.inUse[c] {
+		return
+	}
+	delete(p.inUse, c)
+	if dead || p.closed {
+		p.discard(c)
+		return
+	}
+	// There's always room for the clients of the pool.
+	p.idle <- c
+}
+
+// Close closes the pool, ending the sessions of the idle clients. The
+// clients in use are closed when they're put back.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+	}
+	p.mu.Unlock()
+	var errs []error
+	for {
+		select {
+		case c := <-p.idle:
+			errs = append(errs, c.Quit())
+			<-p.slots
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+func (p *Pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// discard closes a client and frees its slot.
+func (p *Pool) discard(c *Client) {
+	c.Close()
+	<-p.slots
+}
@@ -0,0 +1,95 @@
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	scripts := [][]exchange{
+		{
+			{"DATE", "111 20240102030405\r\n"},
+			{"DATE", "400 idle for too long\r\n"},
+		},
+		{
+			{"QUIT", "205 bye\r\n"},
+		},
+	}
+	var dialed []*Client
+	p := NewPool(1, func() (*Client, error) {
+		if len(dialed) == len(scripts) {
+			return nil, errors.New("too many connections")
+		}
+		c := newTestClient(t, scripts[len(dialed)]...)
+		dialed = append(dialed, c)
+		return c, nil
+	})
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting a client: %v", err)
+	}
+	// The pool is exhausted.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Got %v from an exhausted pool", err)
+	}
+	p.Put(c)
+	// Reused after a health check.
+	if c2, err := p.Get(context.Background()); err != nil || c2 != c {
+		t.Fatalf("Got %p (%v), wanted the idle client %p", c2, err, c)
+	}
+	p.Put(c)
+	// Replaced after failing the health check.
+	c, err = p.Get(context.Background())
+	if err != nil || len(dialed) != 2 || c != dialed[1] {
+		t.Fatalf("Got %p (%v), wanted a new client", c, err)
+	}
+	p.Put(c)
+	// Putting it back again doesn't hand it out twice.
+	p.Put(c)
+	if len(p.idle) != 1 {
+		t.Fatalf("Got %d idle clients after putting one back twice", len(p.idle))
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Error closing the pool: %v", err)
+	}
+	if _, err := p.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("Got %v from a closed pool", err)
+	}
+}
+
+func TestPoolCloseWakesGet(t *testing.T) {
+	p := NewPool(1, func() (*Client, error) {
+		return newTestClient(t), nil
+	})
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting a client: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.Get(context.Background())
+		errc <- err
+	}()
+	// Let Get wait for a client.
+	time.Sleep(50 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("Error closing the pool: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err != ErrPoolClosed {
+			t.Fatalf("Got %v from a waiting Get, wanted ErrPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Get still waiting after Close")
+	}
+	p.Put(c)
+	if _, _, err := c.Command("DATE", 111); err != ErrClientClosed {
+		t.Errorf("Got %v from a client put back into a closed pool", err)
+	}
+}
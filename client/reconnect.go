@@ -0,0 +1,204 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+	"time"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// credentials are the credentials of the last successful authentication.
+type credentials struct {
+	// The SASL mechanism, or "" for AUTHINFO USER and PASS.
+	mechanism  string
+	user, pass string
+}
+
+// remember keeps the credentials of a successful authentication, if the
+// client is to remember them.
+func (c *Client) remember(creds credentials) {
+	if c.RememberCredentials {
+		c.creds = &creds
+	}
+}
+
+// A RetryPolicy makes the client reconnect and try again when a call
+// fails with a transient error: a 400 response (the server ending the
+// session, e.g. after being idle), a connection reset or closed by the
+// server, or a previously truncated response.
+//
+// Only calls that can safely be repeated are retried: Group,
+// Article, Head, Body (up to the start of the article), Stat, Over and
+// Hdr, and their Context variants.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a call is tried again.
+	MaxRetries int
+	// Backoff is the time waited before the first retry, which doubles
+	// with every retry.
+	Backoff time.Duration
+}
+
+// Reconnect replaces the connection with a new one, and restores the
+// session: STARTTLS if it was used, authentication if the credentials
+// were remembered (see RememberCredentials), compression, and the
+// selected group. CurrentGroup then reports the group as it was
+// selected again, or none if that failed.
+//
+// Only clients made by New or NewTLS can reconnect.
+func (c *Client) Reconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed.Store(false)
+	return c.reconnect()
+}
+
+func (c *Client) reconnect() error {
+	if c.addr == "" {
+		return errors.New("reconnecting requires a client made by New or NewTLS")
+	}
+	// The client stays broken if no new connection can be made.
+	c.broken = true
+	c.deadlines.mu.Lock()
+	c.raw.Close()
+	c.deadlines.mu.Unlock()
+	var netconn net.Conn
+	var err error
+	if c.implicitTLS != nil {
+		netconn, err = tls.Dial(c.network, c.addr, c.implicitTLS)
+	} else {
+		netconn, err = net.Dial(c.network, c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn := textproto.NewConn(netconn)
+	code, msg, err := readBanner(conn)
+	if err != nil {
+		netconn.Close()
+		return err
+	}
+	c.deadlines.mu.Lock()
+	if c.closed.Load() {
+		// Closed meanwhile by Close.
+		c.deadlines.mu.Unlock()
+		netconn.Close()
+		return ErrClientClosed
+	}
+	c.netconn = netconn
+	c.raw = netconn
+	c.deadlines.mu.Unlock()
+	// Apply the deadlines to the new connection.
+	c.updateDeadline(func(*deadlines) {})
+	c.conn = conn
+	c.Banner = msg
+	c.PostingAllowed = code == 200
+	c.tls = c.implicitTLS != nil
+	c.broken = false
+	c.capabilities = nil
+	c.overviewFmt = nil
+	c.xfeatureGzip = false
+	compressed := c.compressed
+	c.compressed = false
+
+	if c.startTLSConfig != nil {
+		if err := c.startTLS(c.startTLSConfig); err != nil {
+			return err
+		}
+	}
+	if c.creds != nil {
+		if c.creds.mechanism != "" {
+			err = c.authSASL(c.creds.mechanism, c.creds.user, c.creds.pass)
+		} else {
+			_, err = c.authenticate(c.creds.user, c.creds.pass)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if compressed {
+		if err := c.compress(); err != nil {
+			return err
+		}
+	}
+	// The group is forgotten unless selecting it again succeeds.
+	if g := c.currentGroup; g != nil {
+		c.currentGroup = nil
+		if _, err := c.group(g.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transient reports whether an error may go away by reconnecting.
+func transient(err error) bool {
+	var ne nntp.Error
+	if errors.As(err, &ne) {
+		return ne.Code == 400
+	}
+	return errors.Is(err, ErrConnectionBroken) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retry calls f, and again after reconnecting as long as it fails with
+// a transient error, according to the client's RetryPolicy. c.mu is
+// held by the caller.
+func retry[T any](ctx context.Context, c *Client, f func() (T, error)) (T, error) {
+	v, err := f()
+	if c.Retry == nil {
+		return v, err
+	}
+	backoff := c.Retry.Backoff
+	for i := 0; i < c.Retry.MaxRetries && transient(err) && !c.closed.Load(); i++ {
+		select {
+		case <-ctx.Done():
+			return v, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if rerr := c.reconnect(); rerr != nil {
+			if transient(rerr) {
+				err = rerr
+				continue
+			}
+			return v, rerr
+		}
+		v, err = f()
+	}
+	return v, err
+}
@@ -0,0 +1,87 @@
+package nntpclient
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReconnectServer returns the address of a server which plays back a
+// script on each connection, in turn.
+func newReconnectServer(t *testing.T, scripts ...[]exchange) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for _, script := range scripts {
+			sconn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serveScript(t, sconn, script)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestReconnect(t *testing.T) {
+	addr := newReconnectServer(t,
+		[]exchange{
+			{"authinfo user fred", "381 more\r\n"},
+			{"authinfo pass secret", "281 ok\r\n"},
+			{"GROUP misc.test", "211 3 1 4 misc.test\r\n"},
+			{"STAT 1", "400 idle for too long\r\n"},
+		},
+		[]exchange{
+			{"authinfo user fred", "381 more\r\n"},
+			{"authinfo pass secret", "281 ok\r\n"},
+			{"GROUP misc.test", "211 3 1 4 misc.test\r\n"},
+			// The connection is then closed.
+			{"STAT 1", "223 1 <a@example.com>\r\n"},
+		},
+		[]exchange{
+			{"authinfo user fred", "381 more\r\n"},
+			{"authinfo pass secret", "281 ok\r\n"},
+			{"GROUP misc.test", "211 4 1 5 misc.test\r\n"},
+			{"STAT 2", "223 2 <b@example.com>\r\n"},
+		},
+	)
+	c, err := New("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer c.Close()
+	c.RememberCredentials = true
+	c.Retry = &RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}
+	if _, err := c.Authenticate("fred", "secret"); err != nil {
+		t.Fatalf("Error authenticating: %v", err)
+	}
+	if _, err := c.Group("misc.test"); err != nil {
+		t.Fatalf("Error selecting group: %v", err)
+	}
+	for _, test := range []struct {
+		specifier, msgID string
+	}{
+		{"1", "<a@example.com>"},
+		{"2", "<b@example.com>"},
+	} {
+		_, msgID, err := c.Stat(test.specifier)
+		if err != nil || msgID != test.msgID {
+			t.Errorf("Got %q (%v), wanted %q", msgID, err, test.msgID)
+		}
+	}
+	if g, ok := c.CurrentGroup(); !ok || g.High != 5 {
+		t.Errorf("Got current group %+v, %v after reconnecting", g, ok)
+	}
+}
+
+func TestReconnectNeedsAddress(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.Reconnect(); err == nil || !strings.Contains(err.Error(), "New") {
+		t.Errorf("Got %v reconnecting a client made by NewConn", err)
+	}
+}
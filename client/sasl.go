@@ -0,0 +1,187 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// A saslMechanism is the client side of a SASL mechanism.
+type saslMechanism interface {
+	// Start returns the initial response, or nil if there's none.
+	Start() []byte
+	// Next returns the response to a server challenge.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// newSASLMechanism returns the named mechanism for the credentials.
+func newSASLMechanism(mechanism, user, pass string) (saslMechanism, error) {
+	switch mechanism {
+	case "PLAIN":
+		return saslPlain{user: user, pass: pass}, nil
+	case "CRAM-MD5":
+		return saslCRAMMD5{user: user, pass: pass}, nil
+	}
+	return nil, fmt.Errorf("SASL mechanism %s not supported", mechanism)
+}
+
+// AuthSASL authenticates with AUTHINFO SASL using the named mechanism.
+// PLAIN and CRAM-MD5 are supported; unlike PLAIN, CRAM-MD5 doesn't send
+// the password in the clear.
+//
+// The server has to offer the mechanism in its SASL capability;
+// capabilities are retrieved first if necessary.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4643#section-2.4
+func (c *Client) AuthSASL(mechanism, user, pass string) error {
+	return c.AuthSASLContext(context.Background(), mechanism, user, pass)
+}
+
+// AuthSASLContext is like AuthSASL, but gives up once ctx is done,
+// leaving the connection broken.
+func (c *Client) AuthSASLContext(ctx context.Context, mechanism, user, pass string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.withContext(ctx, func() error {
+		return c.authSASL(mechanism, user, pass)
+	})
+	if err == nil {
+		c.remember(credentials{mechanism: mechanism, user: user, pass: pass})
+	}
+	return err
+}
+
+func (c *Client) authSASL(mechanism, user, pass string) error {
+	m, err := newSASLMechanism(mechanism, user, pass)
+	if err != nil {
+		return err
+	}
+	if c.capabilities == nil {
+		if _, err := c.fetchCapabilities(); err != nil {
+			return err
+		}
+	}
+	_, offered := c.authMethods()
+	found := false
+	for _, name := range offered {
+		found = found || name == mechanism
+	}
+	if !found {
+		return fmt.Errorf("SASL mechanism %s not offered by server", mechanism)
+	}
+
+	cmd := "AUTHINFO SASL " + mechanism
+	if initial := m.Start(); initial != nil {
+		cmd += " " + saslEncode(initial)
+	}
+	if err := c.send("%s", cmd); err != nil {
+		return err
+	}
+	for {
+		code, msg, err := c.readCodeLine(0)
+		if err != nil {
+			return err
+		}
+		switch code {
+		case 281, 283:
+			// Additional data sent with 283 isn't needed by the
+			// supported mechanisms.
+			c.PostingAllowed = true
+			return nil
+		case 383:
+		default:
+			return nntp.Error{Code: code, Msg: msg}
+		}
+		challenge, err := base64.StdEncoding.DecodeString(msg)
+		if err != nil {
+			return c.cancelSASL(fmt.Errorf("invalid SASL challenge: %w", err))
+		}
+		response, err := m.Next(challenge)
+		if err != nil {
+			return c.cancelSASL(err)
+		}
+		if err := c.send("%s", saslEncode(response)); err != nil {
+			return err
+		}
+	}
+}
+
+// cancelSASL cancels an AUTHINFO SASL exchange after err, reading the
+// server's failure response.
+func (c *Client) cancelSASL(err error) error {
+	if serr := c.send("*"); serr != nil {
+		return serr
+	}
+	if _, _, rerr := c.readCodeLine(0); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// saslEncode encodes a SASL response, "=" standing for an empty one.
+func saslEncode(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// RFC 4616
+type saslPlain struct {
+	user, pass string
+}
+
+func (p saslPlain) Start() []byte {
+	return []byte("\x00" + p.user + "\x00" + p.pass)
+}
+
+func (p saslPlain) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("unexpected SASL PLAIN challenge")
+}
+
+// RFC 2195
+type saslCRAMMD5 struct {
+	user, pass string
+}
+
+func (m saslCRAMMD5) Start() []byte {
+	return nil
+}
+
+func (m saslCRAMMD5) Next(challenge []byte) ([]byte, error) {
+	h := hmac.New(md5.New, []byte(m.pass))
+	h.Write(challenge)
+	return []byte(m.user + " " + hex.EncodeToString(h.Sum(nil))), nil
+}
@@ -0,0 +1,56 @@
+package nntpclient
+
+import (
+	"testing"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+func TestAuthSASLPlain(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nAUTHINFO SASL\r\nSASL PLAIN\r\n.\r\n"},
+		// "\x00fred\x00secret"
+		exchange{"AUTHINFO SASL PLAIN AGZyZWQAc2VjcmV0", "481 Authentication failed\r\n"},
+		exchange{"AUTHINFO SASL PLAIN AGZyZWQAc2VjcmV0", "281 Authentication accepted\r\n"},
+	)
+	if err := c.AuthSASL("DIGEST-MD5", "fred", "secret"); err == nil {
+		t.Errorf("Unsupported mechanism accepted")
+	}
+	err := c.AuthSASL("PLAIN", "fred", "secret")
+	if e, ok := err.(nntp.Error); !ok || e.Code != 481 {
+		t.Errorf("Got %v, wanted a 481 error", err)
+	}
+	if err := c.AuthSASL("PLAIN", "fred", "secret"); err != nil {
+		t.Errorf("Error authenticating: %v", err)
+	}
+}
+
+func TestAuthSASLNotOffered(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nAUTHINFO USER\r\n.\r\n"},
+	)
+	if err := c.AuthSASL("PLAIN", "fred", "secret"); err == nil {
+		t.Errorf("Mechanism accepted without being offered")
+	}
+}
+
+func TestAuthSASLCRAMMD5(t *testing.T) {
+	// The example of RFC 2195.
+	c := newTestClient(t,
+		exchange{"CAPABILITIES",
+			"101 Capability list:\r\nVERSION 2\r\nAUTHINFO SASL\r\nSASL PLAIN CRAM-MD5\r\n.\r\n"},
+		exchange{"AUTHINFO SASL CRAM-MD5",
+			"383 PDE4OTYuNjk3MTcwOTUyQHBvc3RvZmZpY2UucmVzdG9uLm1jaS5uZXQ+\r\n"},
+		exchange{"dGltIGI5MTNhNjAyYzdlZGE3YTQ5NWI0ZTZlNzMzNGQzODkw", "281 Authentication accepted\r\n"},
+		exchange{"AUTHINFO SASL CRAM-MD5", "383 not base64!\r\n"},
+		exchange{"*", "481 Authentication cancelled\r\n"},
+	)
+	if err := c.AuthSASL("CRAM-MD5", "tim", "tanstaaftanstaaf"); err != nil {
+		t.Errorf("Error authenticating: %v", err)
+	}
+	if err := c.AuthSASL("CRAM-MD5", "tim", "tanstaaftanstaaf"); err == nil {
+		t.Errorf("Invalid challenge accepted")
+	}
+}
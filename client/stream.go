@@ -0,0 +1,253 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// FeedWindow is the number of commands FeedStream keeps outstanding.
+const FeedWindow = 16
+
+// A FeedItem is an article offered by FeedStream.
+type FeedItem struct {
+	MessageID string
+	// The entire article, headers and body, in RFC822ish format.
+	Body io.Reader
+}
+
+// FeedStatus is the outcome of offering an article.
+type FeedStatus int
+
+// FeedStatus values.
+const (
+	// FeedAccepted means the server took the article (239).
+	FeedAccepted FeedStatus = iota
+	// FeedRefused means the server didn't want the article (438).
+	FeedRefused
+	// FeedDeferred means the server asked for the article to be
+	// offered again later (431).
+	FeedDeferred
+	// FeedRejected means the server rejected the transferred article
+	// (439).
+	FeedRejected
+)
+
+// A FeedResult reports the outcome of offering a FeedItem.
+type FeedResult struct {
+	MessageID string
+	Status    FeedStatus
+}
+
+// feedCommand is a command awaiting its response.
+type feedCommand struct {
+	item     FeedItem
+	takethis bool
+}
+
+// FeedStream feeds articles to the server in streaming mode (RFC 4644).
+//
+// After MODE STREAM, the articles are offered with pipelined CHECK
+// commands, and those the server wants are sent with TAKETHIS. The
+// outcome of every article is sent on results, in the order the
+// responses arrive; FeedStream blocks while results isn't read.
+//
+// FeedStream returns once articles is closed and all results have been
+// reported, or on the first error, which leaves the connection in an
+// unknown state.
+func (c *Client) FeedStream(articles <-chan FeedItem, results chan<- FeedResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.modeStream(); err != nil {
+		return err
+	}
+	var pending []feedCommand
+	for articles != nil || len(pending) > 0 {
+		// Offer more articles, waiting for one only if nothing is
+		// outstanding.
+	offer:
+		for articles != nil && len(pending) < FeedWindow {
+			var item FeedItem
+			var ok bool
+			if len(pending) == 0 {
+				item, ok = <-articles
+			} else {
+				select {
+				case item, ok = <-articles:
+				default:
+					break offer
+				}
+			}
+			if !ok {
+				articles = nil
+				break
+			}
+			if err := c.send("CHECK %s", item.MessageID); err != nil {
+				return err
+			}
+			pending = append(pending, feedCommand{item: item})
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		cmd := pending[0]
+		pending = pending[1:]
+		code, _, err := c.readCodeLine(0)
+		if err != nil {
+			c.broken = true
+			return err
+		}
+		result := FeedResult{MessageID: cmd.item.MessageID}
+		switch {
+		case !cmd.takethis && code == 238:
+			if err := c.takeThis(cmd.item); err != nil {
+				return err
+			}
+			pending = append(pending, feedCommand{item: cmd.item, takethis: true})
+			continue
+		case !cmd.takethis && code == 438:
+			result.Status = FeedRefused
+		case !cmd.takethis && code == 431:
+			result.Status = FeedDeferred
+		case cmd.takethis && code == 239:
+			result.Status = FeedAccepted
+		case cmd.takethis && code == 439:
+			result.Status = FeedRejected
+		default:
+			c.broken = true
+			return nntp.Error{Code: code,
+				Msg: fmt.Sprintf("unexpected response while streaming %s", cmd.item.MessageID)}
+		}
+		results <- result
+	}
+	return nil
+}
+
+// takeThis sends an article with TAKETHIS, without waiting for the
+// response.
+func (c *Client) takeThis(item FeedItem) error {
+	if err := c.send("TAKETHIS %s", item.MessageID); err != nil {
+		return err
+	}
+	w := c.conn.DotWriter()
+	if _, err := io.Copy(w, item.Body); err != nil {
+		// The server would take the partial article.
+		c.broken = true
+		return err
+	}
+	return w.Close()
+}
+
+// ModeStream switches the connection to streaming mode (RFC 4644), which
+// Check and TakeThis require.
+func (c *Client) ModeStream() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.modeStream()
+}
+
+func (c *Client) modeStream() error {
+	_, _, err := c.command("MODE STREAM", 203)
+	return err
+}
+
+// ErrTakeThisRejected is returned by TakeThis when the server rejects
+// the article (439).
+var ErrTakeThisRejected = errors.New("article rejected")
+
+// Check asks the server whether it wants an article, and reports true if
+// it does (238) or false if it doesn't (438). A server that wants the
+// article offered again later (431) gets an nntp.Error with that code.
+//
+// The connection must be in streaming mode; see ModeStream.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4644#section-2.3
+func (c *Client) Check(id string) (bool, error) {
+	return c.CheckContext(context.Background(), id)
+}
+
+// CheckContext is like Check, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) CheckContext(ctx context.Context, id string) (wanted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.withContext(ctx, func() error {
+		wanted, err = c.check(id)
+		return err
+	})
+	return wanted, err
+}
+
+func (c *Client) check(id string) (bool, error) {
+	if err := c.send("CHECK %s", id); err != nil {
+		return false, err
+	}
+	code, msg, err := c.readCodeLine(0)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case 238:
+		return true, nil
+	case 438:
+		return false, nil
+	}
+	return false, nntp.Error{Code: code, Msg: msg}
+}
+
+// TakeThis sends an article, read from r with its headers, without
+// asking first, and waits for the server to accept (239) or reject (439,
+// reported as ErrTakeThisRejected) it.
+//
+// The connection must be in streaming mode; see ModeStream.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4644#section-2.5
+func (c *Client) TakeThis(id string, r io.Reader) error {
+	return c.TakeThisContext(context.Background(), id, r)
+}
+
+// TakeThisContext is like TakeThis, but gives up once ctx is done, leaving the
+// connection broken.
+func (c *Client) TakeThisContext(ctx context.Context, id string, r io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.withContext(ctx, func() error {
+		if err := c.takeThis(FeedItem{MessageID: id, Body: r}); err != nil {
+			return err
+		}
+		_, _, err := c.readCodeLine(239)
+		if e, ok := err.(nntp.Error); ok && e.Code == 439 {
+			return fmt.Errorf("%w: %w", ErrTakeThisRejected, err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,103 @@
+package nntpclient
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+func TestFeedStream(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"MODE STREAM", "203 Streaming permitted\r\n"},
+		exchange{"CHECK <1@example.com>", "238 <1@example.com>\r\n"},
+		exchange{"CHECK <2@example.com>", "438 <2@example.com>\r\n"},
+		exchange{"CHECK <3@example.com>", "431 <3@example.com>\r\n"},
+		exchange{"CHECK <4@example.com>", "238 <4@example.com>\r\n"},
+		exchange{"TAKETHIS <1@example.com>", ""},
+		exchange{"Message-ID: <1@example.com>", ""},
+		exchange{"", ""},
+		exchange{"..dotted", ""},
+		exchange{".", "239 <1@example.com>\r\n"},
+		exchange{"TAKETHIS <4@example.com>", ""},
+		exchange{"Message-ID: <4@example.com>", ""},
+		exchange{"", ""},
+		exchange{"body", ""},
+		exchange{".", "439 <4@example.com>\r\n"},
+	)
+	articles := make(chan FeedItem, 4)
+	for _, id := range []string{"1", "2", "3", "4"} {
+		body := "body"
+		if id == "1" {
+			body = ".dotted"
+		}
+		articles <- FeedItem{
+			MessageID: "<" + id + "@example.com>",
+			Body:      strings.NewReader("Message-ID: <" + id + "@example.com>\n\n" + body + "\n"),
+		}
+	}
+	close(articles)
+	results := make(chan FeedResult, 4)
+	if err := c.FeedStream(articles, results); err != nil {
+		t.Fatalf("Error feeding: %v", err)
+	}
+	close(results)
+	expected := map[string]FeedStatus{
+		"<1@example.com>": FeedAccepted,
+		"<2@example.com>": FeedRefused,
+		"<3@example.com>": FeedDeferred,
+		"<4@example.com>": FeedRejected,
+	}
+	for r := range results {
+		if r.Status != expected[r.MessageID] {
+			t.Errorf("Got %v for %s, wanted %v", r.Status, r.MessageID, expected[r.MessageID])
+		}
+		delete(expected, r.MessageID)
+	}
+	if len(expected) > 0 {
+		t.Fatalf("No results for %v", expected)
+	}
+}
+
+func TestCheckTakeThis(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"MODE STREAM", "203 Streaming permitted\r\n"},
+		exchange{"CHECK <1@example.com>", "238 <1@example.com>\r\n"},
+		exchange{"CHECK <2@example.com>", "438 <2@example.com>\r\n"},
+		exchange{"CHECK <3@example.com>", "431 <3@example.com>\r\n"},
+		exchange{"TAKETHIS <1@example.com>", ""},
+		exchange{"Message-ID: <1@example.com>", ""},
+		exchange{"", ""},
+		exchange{"body", ""},
+		exchange{".", "239 <1@example.com>\r\n"},
+		exchange{"TAKETHIS <4@example.com>", ""},
+		exchange{"Message-ID: <4@example.com>", ""},
+		exchange{"", ""},
+		exchange{"body", ""},
+		exchange{".", "439 <4@example.com>\r\n"},
+	)
+	if err := c.ModeStream(); err != nil {
+		t.Fatalf("Error entering streaming mode: %v", err)
+	}
+	if want, err := c.Check("<1@example.com>"); err != nil || !want {
+		t.Errorf("Got %v, %v for wanted article", want, err)
+	}
+	if want, err := c.Check("<2@example.com>"); err != nil || want {
+		t.Errorf("Got %v, %v for unwanted article", want, err)
+	}
+	var ne nntp.Error
+	if _, err := c.Check("<3@example.com>"); !errors.As(err, &ne) || ne.Code != 431 {
+		t.Errorf("Got %v for deferred article", err)
+	}
+	article := func(id string) io.Reader {
+		return strings.NewReader("Message-ID: " + id + "\n\nbody\n")
+	}
+	if err := c.TakeThis("<1@example.com>", article("<1@example.com>")); err != nil {
+		t.Errorf("Error sending article: %v", err)
+	}
+	if err := c.TakeThis("<4@example.com>", article("<4@example.com>")); !errors.Is(err, ErrTakeThisRejected) {
+		t.Errorf("Got %v for rejected article", err)
+	}
+}
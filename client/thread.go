@@ -0,0 +1,156 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ */
+
+package nntpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// FetchThread fetches the thread around the article rootID: up to
+// maxDepth of its closest ancestors, as listed in its References
+// header, the article itself, and its follow-ups up to maxDepth levels
+// down. Follow-ups are found from the overview data of the first group
+// the article was posted to, so they are only found if the server
+// supports OVER.
+//
+// The articles are returned ancestors first, oldest first, then the
+// article, then the follow-ups level by level. Articles are fetched
+// once even if referenced repeatedly, and articles that are no longer
+// available are skipped.
+func (c *Client) FetchThread(rootID string, maxDepth int) ([]*nntp.Article, error) {
+	root, err := c.fetchArticle(rootID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{rootID: true}
+	var thread []*nntp.Article
+
+	refs := nntp.ParseReferences(root.Header.Get("References"))
+	if len(refs) > maxDepth {
+		refs = refs[len(refs)-maxDepth:]
+	}
+	for _, id := range refs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		a, err := c.fetchArticle(id)
+		if isMissing(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		thread = append(thread, a)
+	}
+	thread = append(thread, root)
+
+	group, _, _ := strings.Cut(root.Header.Get("Newsgroups"), ",")
+	children, err := c.followUps(strings.TrimSpace(group))
+	if err != nil {
+		return nil, err
+	}
+	level := []string{rootID}
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		var next []string
+		for _, parent := range level {
+			for _, id := range children[parent] {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				a, err := c.fetchArticle(id)
+				if isMissing(err) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				thread = append(thread, a)
+				next = append(next, id)
+			}
+		}
+		level = next
+	}
+	return thread, nil
+}
+
+// isMissing reports whether an error is a response saying an article
+// isn't available.
+func isMissing(err error) bool {
+	e, ok := err.(nntp.Error)
+	return ok && (e.Code == 423 || e.Code == 430)
+}
+
+// fetchArticle fetches an article and parses its headers.
+func (c *Client) fetchArticle(id string) (*nntp.Article, error) {
+	_, a, err := c.ArticleParsed(id)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(a.Body)
+	if err != nil {
+		return nil, err
+	}
+	a.Body = bytes.NewReader(body)
+	a.Bytes = len(body)
+	a.Lines = bytes.Count(body, []byte{'\n'})
+	return a, nil
+}
+
+// followUps maps the message-ids in the overview data of a group to the
+// ids of their direct follow-ups. Error responses (e.g. for a server
+// without OVER) give an empty map.
+func (c *Client) followUps(group string) (map[string][]string, error) {
+	children := map[string][]string{}
+	if group == "" {
+		return children, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, err := c.group(group)
+	if err == nil && g.Low <= g.High {
+		var items []OverItem
+		items, err = c.over(fmt.Sprintf("OVER %d-%d", g.Low, g.High))
+		for _, item := range items {
+			refs := nntp.ParseReferences(item.References)
+			if len(refs) > 0 {
+				parent := refs[len(refs)-1]
+				children[parent] = append(children[parent], item.MessageId)
+			}
+		}
+	}
+	if _, ok := err.(nntp.Error); ok {
+		err = nil
+	}
+	return children, err
+}
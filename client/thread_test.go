@@ -0,0 +1,41 @@
+package nntpclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func threadArticle(id, refs string) string {
+	return "220 0 " + id + "\r\nMessage-ID: " + id + "\r\nNewsgroups: misc.test,alt.test\r\n" +
+		"References: " + refs + "\r\n\r\nbody\r\n.\r\n"
+}
+
+func TestFetchThread(t *testing.T) {
+	c := newTestClient(t,
+		exchange{"ARTICLE <b@x>", threadArticle("<b@x>", "<z@x> <a@x>")},
+		exchange{"ARTICLE <z@x>", "430 No such article\r\n"},
+		exchange{"ARTICLE <a@x>", threadArticle("<a@x>", "")},
+		exchange{"GROUP misc.test", "211 5 1 5 misc.test\r\n"},
+		exchange{"OVER 1-5", "224 overview\r\n" +
+			// <a@x> following up to <b@x> makes a cycle.
+			"1\ts\tf\td\t<a@x>\t<b@x>\t1\t1\r\n" +
+			"2\ts\tf\td\t<b@x>\t<z@x> <a@x>\t1\t1\r\n" +
+			"3\ts\tf\td\t<c@x>\t<a@x> <b@x>\t1\t1\r\n" +
+			"4\ts\tf\td\t<d@x>\t<b@x>\t1\t1\r\n" +
+			"5\ts\tf\td\t<e@x>\t<b@x> <c@x>\t1\t1\r\n.\r\n"},
+		exchange{"ARTICLE <c@x>", threadArticle("<c@x>", "<a@x> <b@x>")},
+		exchange{"ARTICLE <d@x>", threadArticle("<d@x>", "<b@x>")},
+		exchange{"ARTICLE <e@x>", threadArticle("<e@x>", "<b@x> <c@x>")},
+	)
+	thread, err := c.FetchThread("<b@x>", 2)
+	if err != nil {
+		t.Fatalf("Error fetching thread: %v", err)
+	}
+	var ids []string
+	for _, a := range thread {
+		ids = append(ids, a.MessageID())
+	}
+	if got := strings.Join(ids, " "); got != "<a@x> <b@x> <c@x> <d@x> <e@x>" {
+		t.Fatalf("Got thread %q", got)
+	}
+}
@@ -0,0 +1,154 @@
+package nntpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kothawoc/go-nntp/internal/testcert"
+)
+
+func handshake(t *testing.T, cert tls.Certificate, config *tls.Config) error {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		sconn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		sconn.SetDeadline(time.Now().Add(5 * time.Second))
+		tls.Server(sconn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+	}()
+	cconn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer cconn.Close()
+	cconn.SetDeadline(time.Now().Add(5 * time.Second))
+	return tls.Client(cconn, config).Handshake()
+}
+
+func TestPinCertificate(t *testing.T) {
+	cert := testcert.New(t)
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	base := &tls.Config{InsecureSkipVerify: true}
+
+	if err := handshake(t, cert, PinCertificate(base, fingerprint[:])); err != nil {
+		t.Fatalf("Error with the pinned certificate: %v", err)
+	}
+
+	wrong := make([]byte, len(fingerprint))
+	err := handshake(t, cert, PinCertificate(base, wrong))
+	var mismatch *CertificateMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected CertificateMismatchError, got %v", err)
+	}
+	if base.VerifyConnection != nil {
+		t.Fatalf("PinCertificate modified the original config")
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	cert := testcert.New(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		sconn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		sconn.SetDeadline(time.Now().Add(5 * time.Second))
+		s := textproto.NewConn(sconn)
+		s.PrintfLine("201 test server ready, no posting")
+		s.ReadLine()
+	}()
+	c, err := NewTLS("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer c.Close()
+	if !c.HasTLS() || c.Banner != "test server ready, no posting" || c.PostingAllowed {
+		t.Errorf("Got TLS %v, banner %q and posting allowed %v",
+			c.HasTLS(), c.Banner, c.PostingAllowed)
+	}
+	if cs, ok := c.ConnectionState(); !ok || !cs.HandshakeComplete || len(cs.PeerCertificates) != 1 {
+		t.Errorf("Got TLS state %v, %v", cs, ok)
+	}
+	if err := c.Post(strings.NewReader("Subject: test\r\n\r\nbody\r\n")); err != ErrPostingNotAllowed {
+		t.Errorf("Got %v posting, wanted %v", err, ErrPostingNotAllowed)
+	}
+}
+
+func TestStartTLSServerName(t *testing.T) {
+	cert := testcert.New(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			sconn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer sconn.Close()
+				sconn.SetDeadline(time.Now().Add(5 * time.Second))
+				s := textproto.NewConn(sconn)
+				s.PrintfLine("200 test server ready")
+				s.ReadLine()
+				s.PrintfLine("382 go ahead")
+				tconn := tls.Server(sconn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if tconn.Handshake() != nil {
+					return
+				}
+				s = textproto.NewConn(tconn)
+				s.ReadLine()
+				s.PrintfLine("101 Capability list:\r\nVERSION 2\r\n.")
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	tests := []struct {
+		config *tls.Config
+		ok     bool
+	}{
+		// Verified against the host name connected to.
+		{&tls.Config{RootCAs: roots}, true},
+		{&tls.Config{RootCAs: roots, ServerName: "example.com"}, false},
+		{&tls.Config{InsecureSkipVerify: true}, true},
+	}
+	for _, test := range tests {
+		c, err := New("tcp", net.JoinHostPort("localhost", port))
+		if err != nil {
+			t.Fatalf("Error connecting: %v", err)
+		}
+		if err := c.StartTLS(test.config); (err == nil) != test.ok {
+			t.Errorf("Got %v with ServerName %q", err, test.config.ServerName)
+		}
+		c.Close()
+	}
+}
@@ -300,7 +300,7 @@ func main() {
 	maybefatal(err, "Error setting up listener: %v", err)
 	defer l.Close()
 
-	s := nntpserver.NewServer(&testBackend, idGen)
+	s := nntpserver.NewServer(nntpserver.AdaptBackend(&testBackend), idGen)
 
 	for {
 		c, err := l.AcceptTCP()
@@ -1,3 +1,5 @@
 module github.com/kothawoc/go-nntp
 
 go 1.23.0
+
+require golang.org/x/text v0.21.0
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // PostingStatus type for groups.
@@ -16,10 +20,18 @@ const (
 	PostingPermitted    = PostingStatus('y')
 	PostingNotPermitted = PostingStatus('n')
 	PostingModerated    = PostingStatus('m')
+	PostingNoLocal      = PostingStatus('x') // only accepted from peers
+	PostingJunked       = PostingStatus('j') // filed into the junk group
 )
 
+// String returns the status as listed by LIST ACTIVE: "y", "n", "m", "x"
+// or "j". Unknown statuses are listed as "n".
 func (ps PostingStatus) String() string {
-	return fmt.Sprintf("%c", ps)
+	switch ps {
+	case PostingPermitted, PostingModerated, PostingNoLocal, PostingJunked:
+		return string(rune(ps))
+	}
+	return "n"
 }
 
 // Group represents a usenet newsgroup.
@@ -32,6 +44,123 @@ type Group struct {
 	Posting     PostingStatus
 }
 
+// String returns the group as a LIST ACTIVE line: the name, the high and
+// low water marks and the posting status.
+func (g Group) String() string {
+	return fmt.Sprintf("%s %d %d %v", g.Name, g.High, g.Low, g.Posting)
+}
+
+// BuildActiveList returns the LIST ACTIVE lines of groups, as found in
+// an active file.
+func BuildActiveList(groups []Group) []string {
+	lines := make([]string, len(groups))
+	for i, g := range groups {
+		lines[i] = g.String()
+	}
+	return lines
+}
+
+// ParseActiveList parses LIST ACTIVE lines, as built by BuildActiveList.
+// Unknown posting statuses are taken as PostingNotPermitted.
+func ParseActiveList(lines []string) ([]Group, error) {
+	groups := make([]Group, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid active line %q", line)
+		}
+		high, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active line %q", line)
+		}
+		low, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active line %q", line)
+		}
+		groups = append(groups, Group{
+			Name:    fields[0],
+			High:    high,
+			Low:     low,
+			Posting: ParsePostingStatus(fields[3]),
+		})
+	}
+	return groups, nil
+}
+
+// A GroupTime is a LIST ACTIVE.TIMES entry: when a group was created,
+// and by whom.
+type GroupTime struct {
+	Name    string
+	Created time.Time
+	// Creator is an email address or other identity of the creator.
+	Creator string
+}
+
+// ParseActiveTimes parses LIST ACTIVE.TIMES lines, which give the group
+// name, its creation time in seconds since the epoch and its creator.
+// The fields may be separated by any run of spaces and tabs. Some
+// servers put spaces in the creator, which is the rest of the line.
+func ParseActiveTimes(lines []string) ([]GroupTime, error) {
+	groups := make([]GroupTime, 0, len(lines))
+	for _, line := range lines {
+		name, rest := cutField(line)
+		created, rest := cutField(rest)
+		creator := strings.TrimSpace(rest)
+		if name == "" || creator == "" {
+			return nil, fmt.Errorf("invalid active.times line %q", line)
+		}
+		secs, err := strconv.ParseInt(created, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active.times line %q", line)
+		}
+		groups = append(groups, GroupTime{
+			Name:    name,
+			Created: time.Unix(secs, 0).UTC(),
+			Creator: creator,
+		})
+	}
+	return groups, nil
+}
+
+// cutField returns the first field of s, as split by strings.Fields,
+// and the rest of s after it.
+func cutField(s string) (field, rest string) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// ParsePostingStatus parses a status as listed by LIST ACTIVE. Unknown
+// statuses are taken as PostingNotPermitted.
+func ParsePostingStatus(s string) PostingStatus {
+	switch s {
+	case "y":
+		return PostingPermitted
+	case "m":
+		return PostingModerated
+	case "x":
+		return PostingNoLocal
+	case "j":
+		return PostingJunked
+	}
+	return PostingNotPermitted
+}
+
+// Error is an error response from an NNTP server, as returned by the
+// client when a response doesn't have the expected code. Use errors.As
+// to tell responses (e.g. 400 or 503, worth retrying after reconnecting)
+// from transport errors.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%03d %s", e.Code, e.Msg)
+}
+
 // An Article that may appear in one or more groups.
 type Article struct {
 	// The article's headers
@@ -48,3 +177,79 @@ type Article struct {
 func (a *Article) MessageID() string {
 	return a.Header.Get("Message-Id")
 }
+
+// RequiredPostHeaders are the headers a posted article must have (RFC
+// 5537, section 3.5); Date and Message-ID are usually added by the
+// server.
+var RequiredPostHeaders = []string{"From", "Newsgroups", "Subject"}
+
+// ValidatePostHeaders checks that each of the required headers is
+// present and not empty, and returns an error naming the first one
+// that isn't.
+func ValidatePostHeaders(header textproto.MIMEHeader, required []string) error {
+	for _, name := range required {
+		if strings.TrimSpace(header.Get(name)) == "" {
+			return fmt.Errorf("missing %s header", textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+	return nil
+}
+
+// DiffGroups compares two LIST ACTIVE snapshots, matching groups by name.
+//
+// It returns the groups only present in newer, the groups only present
+// in older, and the groups whose high or low water mark moved (as they
+// appear in newer).
+func DiffGroups(older, newer []Group) (added, removed, changed []Group) {
+	old := make(map[string]Group, len(older))
+	for _, g := range older {
+		old[g.Name] = g
+	}
+	seen := make(map[string]bool, len(newer))
+	for _, g := range newer {
+		seen[g.Name] = true
+		o, ok := old[g.Name]
+		switch {
+		case !ok:
+			added = append(added, g)
+		case o.High != g.High || o.Low != g.Low:
+			changed = append(changed, g)
+		}
+	}
+	for _, g := range older {
+		if !seen[g.Name] {
+			removed = append(removed, g)
+		}
+	}
+	return
+}
+
+// ParseReferences splits a References header into its message-ids,
+// oldest ancestor first.
+//
+// Ids need not be separated by whitespace; anything that isn't a
+// well-formed <...> id without embedded whitespace is skipped.
+func ParseReferences(header string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(header, '<')
+		if start < 0 {
+			break
+		}
+		header = header[start:]
+		end := strings.IndexByte(header, '>')
+		if end < 0 {
+			break
+		}
+		id := header[:end+1]
+		header = header[end+1:]
+		// Skip the unterminated start of a malformed id.
+		if i := strings.LastIndexByte(id, '<'); i > 0 {
+			id = id[i:]
+		}
+		if len(id) > 2 && !strings.ContainsAny(id, " \t\r\n") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
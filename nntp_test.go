@@ -0,0 +1,162 @@
+package nntp
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostingStatusString(t *testing.T) {
+	expectations := map[PostingStatus]string{
+		PostingPermitted:    "y",
+		PostingNotPermitted: "n",
+		PostingModerated:    "m",
+		PostingNoLocal:      "x",
+		PostingJunked:       "j",
+	}
+	for ps, s := range expectations {
+		if ps.String() != s {
+			t.Errorf("Got %q for %v, wanted %q", ps.String(), byte(ps), s)
+		}
+		if got := ParsePostingStatus(s); got != ps {
+			t.Errorf("Round trip of %v gave %v", ps, got)
+		}
+	}
+	if Unknown.String() != "n" || PostingStatus('?').String() != "n" {
+		t.Errorf("Unknown statuses listed as %q and %q", Unknown, PostingStatus('?'))
+	}
+	if ParsePostingStatus("?") != PostingNotPermitted {
+		t.Errorf("Unknown status parsed as %v", ParsePostingStatus("?"))
+	}
+}
+
+func groupNames(groups []Group) string {
+	names := ""
+	for _, g := range groups {
+		names += g.Name + " "
+	}
+	return names
+}
+
+func TestDiffGroups(t *testing.T) {
+	older := []Group{
+		{Name: "alt.test", High: 10, Low: 1},
+		{Name: "misc.test", High: 5, Low: 1},
+		{Name: "comp.old", High: 3, Low: 3},
+	}
+	newer := []Group{
+		{Name: "alt.test", High: 12, Low: 1},
+		{Name: "misc.test", High: 5, Low: 1},
+		{Name: "comp.new", High: 0, Low: 1},
+	}
+	added, removed, changed := DiffGroups(older, newer)
+	if groupNames(added) != "comp.new " {
+		t.Errorf("Got added %q", groupNames(added))
+	}
+	if groupNames(removed) != "comp.old " {
+		t.Errorf("Got removed %q", groupNames(removed))
+	}
+	if groupNames(changed) != "alt.test " || changed[0].High != 12 {
+		t.Errorf("Got changed %#v", changed)
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	expectations := []struct {
+		header string
+		ids    []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"<a@example.com>", []string{"<a@example.com>"}},
+		{"<a@example.com>  <b@example.com>\r\n\t<c@example.com>",
+			[]string{"<a@example.com>", "<b@example.com>", "<c@example.com>"}},
+		{"<a@example.com><b@example.com>",
+			[]string{"<a@example.com>", "<b@example.com>"}},
+		{"<a@exa mple.com> <broken <b@example.com> <> junk",
+			[]string{"<b@example.com>"}},
+	}
+	for _, e := range expectations {
+		ids := ParseReferences(e.header)
+		if strings.Join(ids, " ") != strings.Join(e.ids, " ") {
+			t.Errorf("Error parsing %q, got %q, wanted %q", e.header, ids, e.ids)
+		}
+	}
+}
+
+func TestActiveListRoundTrip(t *testing.T) {
+	groups := []Group{
+		{Name: "misc.test", High: 30, Low: 1, Posting: PostingPermitted},
+		{Name: "alt.moderated", High: 0, Low: 1, Posting: PostingModerated},
+		{Name: "local.only", High: 5, Low: 5, Posting: PostingNoLocal},
+		{Name: "junk", High: 10, Low: 3, Posting: PostingJunked},
+		{Name: "read.only", High: 7, Low: 2, Posting: PostingNotPermitted},
+	}
+	lines := BuildActiveList(groups)
+	if lines[0] != "misc.test 30 1 y" {
+		t.Fatalf("Got %q", lines[0])
+	}
+	parsed, err := ParseActiveList(lines)
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if len(parsed) != len(groups) {
+		t.Fatalf("Got %d groups, wanted %d", len(parsed), len(groups))
+	}
+	for i := range groups {
+		if parsed[i] != groups[i] {
+			t.Errorf("Got %#v, wanted %#v", parsed[i], groups[i])
+		}
+	}
+	if _, err := ParseActiveList([]string{"misc.test 30 y"}); err == nil {
+		t.Fatalf("Expected an error for a short line")
+	}
+}
+
+func TestValidatePostHeaders(t *testing.T) {
+	h := textproto.MIMEHeader{
+		"From":       {"fred@example.com"},
+		"Newsgroups": {"misc.test"},
+	}
+	err := ValidatePostHeaders(h, RequiredPostHeaders)
+	if err == nil || !strings.Contains(err.Error(), "Subject") {
+		t.Fatalf("Got %v, wanted an error naming Subject", err)
+	}
+	h.Set("Subject", " ")
+	if ValidatePostHeaders(h, RequiredPostHeaders) == nil {
+		t.Fatalf("Accepted a blank Subject")
+	}
+	h.Set("Subject", "hi")
+	if err := ValidatePostHeaders(h, RequiredPostHeaders); err != nil {
+		t.Fatalf("Got %v", err)
+	}
+	if err := ValidatePostHeaders(h, []string{"organization"}); err == nil || !strings.Contains(err.Error(), "Organization") {
+		t.Fatalf("Got %v, wanted an error naming Organization", err)
+	}
+}
+
+func TestParseActiveTimes(t *testing.T) {
+	groups, err := ParseActiveTimes([]string{"misc.test 1700000000 fred@example.com"})
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	want := GroupTime{"misc.test", time.Unix(1700000000, 0).UTC(), "fred@example.com"}
+	if len(groups) != 1 || groups[0] != want {
+		t.Fatalf("Got %v, wanted %v", groups, want)
+	}
+	groups, err = ParseActiveTimes([]string{"misc.test 1700000000 Fred Bloggs <fred@example.com>"})
+	if err != nil || len(groups) != 1 || groups[0].Creator != "Fred Bloggs <fred@example.com>" {
+		t.Fatalf("Got %v (%v)", groups, err)
+	}
+	groups, err = ParseActiveTimes([]string{"misc.test\t1700000000  \tFred Bloggs <fred@example.com>"})
+	if err != nil || len(groups) != 1 || groups[0].Name != "misc.test" || groups[0].Creator != "Fred Bloggs <fred@example.com>" {
+		t.Fatalf("Got %v (%v) with tabs and runs of spaces", groups, err)
+	}
+	if _, err := ParseActiveTimes([]string{"misc.test 1700000000 \t"}); err == nil {
+		t.Fatalf("Accepted a line without a creator")
+	}
+	if _, err := ParseActiveTimes([]string{"misc.test yesterday fred"}); err == nil {
+		t.Fatalf("Accepted an invalid time")
+	}
+}
@@ -0,0 +1,94 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An OverviewField is one field of the overview data, as listed by
+// LIST OVERVIEW.FMT.
+type OverviewField struct {
+	// Name is a header name (e.g. "Subject") or a metadata item
+	// (e.g. ":bytes").
+	Name string
+	// Full is set if the field content includes the header name.
+	Full bool
+}
+
+// String returns the field as listed by LIST OVERVIEW.FMT.
+func (f OverviewField) String() string {
+	switch {
+	case strings.HasPrefix(f.Name, ":"):
+		return f.Name
+	case f.Full:
+		return f.Name + ":full"
+	}
+	return f.Name + ":"
+}
+
+// OverviewFmt is the order of the fields in overview data, which follow
+// the article number.
+type OverviewFmt struct {
+	Fields []OverviewField
+}
+
+// DefaultOverviewFmt is the format mandated by RFC 3977, section 8.4.
+var DefaultOverviewFmt = &OverviewFmt{Fields: []OverviewField{
+	{Name: "Subject"},
+	{Name: "From"},
+	{Name: "Date"},
+	{Name: "Message-ID"},
+	{Name: "References"},
+	{Name: ":bytes"},
+	{Name: ":lines"},
+}}
+
+// ParseOverviewFmt parses the lines of a LIST OVERVIEW.FMT response.
+//
+// The "Bytes:" and "Lines:" lines sent by older servers are taken as the
+// ":bytes" and ":lines" metadata items.
+func ParseOverviewFmt(lines []string) (*OverviewFmt, error) {
+	f := &OverviewFmt{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		var field OverviewField
+		switch {
+		case len(line) > 1 && line[0] == ':':
+			field.Name = strings.ToLower(line)
+		case strings.HasSuffix(strings.ToLower(line), ":full") && len(line) > 5:
+			field = OverviewField{Name: line[:len(line)-5], Full: true}
+		case strings.HasSuffix(line, ":") && len(line) > 1:
+			field.Name = line[:len(line)-1]
+			switch strings.ToLower(field.Name) {
+			case "bytes":
+				field.Name = ":bytes"
+			case "lines":
+				field.Name = ":lines"
+			}
+		default:
+			return nil, fmt.Errorf("invalid overview format line %q", line)
+		}
+		f.Fields = append(f.Fields, field)
+	}
+	return f, nil
+}
+
+// Index returns the position of the named field (compared case
+// insensitively) among the fields, or -1 if it isn't present.
+func (f *OverviewFmt) Index(name string) int {
+	for i, field := range f.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Lines returns the format as listed by LIST OVERVIEW.FMT.
+func (f *OverviewFmt) Lines() []string {
+	lines := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		lines[i] = field.String()
+	}
+	return lines
+}
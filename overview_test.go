@@ -0,0 +1,37 @@
+package nntp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOverviewFmt(t *testing.T) {
+	f, err := ParseOverviewFmt([]string{"Subject:", "From:", "Date:",
+		"Message-ID:", "References:", "Bytes:", "Lines:", "Xref:full"})
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	expected := "Subject: From: Date: Message-ID: References: :bytes :lines Xref:full"
+	if got := strings.Join(f.Lines(), " "); got != expected {
+		t.Fatalf("Got %q, wanted %q", got, expected)
+	}
+	if i := f.Index("xref"); i != 7 || !f.Fields[i].Full {
+		t.Fatalf("Xref at %d: %+v", i, f.Fields)
+	}
+	if i := f.Index("Newsgroups"); i != -1 {
+		t.Fatalf("Got index %d for a missing field", i)
+	}
+	if _, err := ParseOverviewFmt([]string{"Subject"}); err == nil {
+		t.Fatalf("Expected an error for an invalid line")
+	}
+}
+
+func TestDefaultOverviewFmt(t *testing.T) {
+	f, err := ParseOverviewFmt(DefaultOverviewFmt.Lines())
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if len(f.Fields) != 7 || f.Index(":lines") != 6 {
+		t.Fatalf("Round trip gave %+v", f.Fields)
+	}
+}
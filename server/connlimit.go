@@ -0,0 +1,79 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"io"
+	"net"
+)
+
+// acquireConn counts a new connection against the MaxConnsPerIP limit of
+// its remote IP address. It returns the address (empty if the
+// connection isn't counted) and whether the connection is allowed.
+func (s *Server) acquireConn(conn io.ReadWriteCloser) (string, bool) {
+	if s.MaxConnsPerIP <= 0 {
+		return "", true
+	}
+	nc, ok := conn.(net.Conn)
+	if !ok {
+		return "", true
+	}
+	addr, ok := nc.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return "", true
+	}
+	if s.TrustedPeer != nil && s.TrustedPeer(addr.IP) {
+		return "", true
+	}
+	ip := addr.IP.String()
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.conns[ip] >= s.MaxConnsPerIP {
+		return ip, false
+	}
+	if s.conns == nil {
+		s.conns = make(map[string]int)
+	}
+	s.conns[ip]++
+	return ip, true
+}
+
+// releaseConn uncounts a connection allowed by acquireConn.
+func (s *Server) releaseConn(ip string) {
+	if ip == "" {
+		return
+	}
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.conns[ip]--; s.conns[ip] <= 0 {
+		delete(s.conns, ip)
+	}
+}
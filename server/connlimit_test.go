@@ -0,0 +1,66 @@
+package nntpserver
+
+import (
+	"net"
+	"net/textproto"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dialServer connects to the server listening on l and reads its
+// greeting.
+func dialServer(t *testing.T, l net.Listener) (*textproto.Conn, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c := textproto.NewConn(conn)
+	t.Cleanup(func() { c.Close() })
+	code, _, err := c.ReadCodeLine(0)
+	if err != nil {
+		t.Fatalf("Error reading greeting: %v", err)
+	}
+	return c, code
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.MaxConnsPerIP = 2
+	var trusted atomic.Bool
+	s.TrustedPeer = func(ip net.IP) bool { return trusted.Load() && ip.IsLoopback() }
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.Process(conn, nil)
+		}
+	}()
+
+	first, _ := dialServer(t, l)
+	dialServer(t, l)
+	if _, code := dialServer(t, l); code != 400 {
+		t.Fatalf("Got %d for a connection over the limit, wanted 400", code)
+	}
+
+	// A connection ending frees its slot.
+	cmd(t, first, 205, "QUIT")
+	first.ReadLine()
+	if _, code := dialServer(t, l); code != 200 {
+		t.Fatalf("Got %d after a connection ended, wanted 200", code)
+	}
+
+	trusted.Store(true)
+	if _, code := dialServer(t, l); code != 200 {
+		t.Fatalf("Got %d for a trusted peer, wanted 200", code)
+	}
+}
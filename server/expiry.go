@@ -0,0 +1,93 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"time"
+)
+
+// An expiry records the low water mark notified by ArticlesExpired.
+type expiry struct {
+	low int64
+	at  time.Time
+}
+
+// maxExpiries is the number of groups whose low water mark
+// ArticlesExpired remembers.
+const maxExpiries = 10000
+
+// ArticlesExpired notifies the server that the articles of a group
+// numbered below low have been expired or removed.
+//
+// Numeric requests for these articles are then answered with 423 (or
+// 420 for the current article) without asking the backend, which may
+// still serve them for a while, and GROUP numbers cached for the group
+// (see GroupCacheTTL) are looked up again.
+//
+// The marks of up to 10000 groups are remembered; beyond that, the
+// group notified least recently is forgotten, and its articles are
+// left to the backend again.
+func (s *Server) ArticlesExpired(group string, low int64) {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+	if s.expired == nil {
+		s.expired = make(map[string]expiry)
+	}
+	e, ok := s.expired[group]
+	if ok && e.low >= low {
+		return
+	}
+	if !ok && len(s.expired) >= maxExpiries {
+		s.forgetOldestExpiry()
+	}
+	s.expired[group] = expiry{low, time.Now()}
+}
+
+// forgetOldestExpiry removes the mark notified least recently.
+func (s *Server) forgetOldestExpiry() {
+	var oldest string
+	var at time.Time
+	for group, e := range s.expired {
+		if oldest == "" || e.at.Before(at) {
+			oldest, at = group, e.at
+		}
+	}
+	delete(s.expired, oldest)
+}
+
+// expiredBelow returns the low water mark notified for a group, and
+// when it was notified.
+func (s *Server) expiredBelow(group string) (int64, time.Time) {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+	e := s.expired[group]
+	return e.low, e.at
+}
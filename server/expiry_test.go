@@ -0,0 +1,50 @@
+package nntpserver
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestArticlesExpired(t *testing.T) {
+	cb := &countingBackend{testBackend: newTestBackend()}
+	s := NewServer(cb, testIDGen{})
+	s.GroupCacheTTL = time.Hour
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 211, "GROUP misc.test")
+	cmd(t, c, 223, "STAT 2")
+	s.ArticlesExpired("misc.test", 3)
+	// The backend still has them.
+	cmd(t, c, 423, "ARTICLE 2")
+	cmd(t, c, 420, "STAT")
+	cmd(t, c, 223, "STAT 3")
+	cmd(t, c, 430, "ARTICLE <nosuch@example.com>")
+
+	// The cached group numbers are stale now.
+	cmd(t, c, 211, "GROUP misc.test")
+	if cb.getGroups != 2 {
+		t.Fatalf("Got %d group lookups, wanted 2", cb.getGroups)
+	}
+	// A lower mark doesn't undo the expiry.
+	s.ArticlesExpired("misc.test", 1)
+	cmd(t, c, 423, "STAT 2")
+}
+
+func TestArticlesExpiredBound(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.ArticlesExpired("first.test", 3)
+	time.Sleep(time.Millisecond)
+	for i := 0; i < maxExpiries; i++ {
+		s.ArticlesExpired(fmt.Sprintf("group%d.test", i), 3)
+	}
+	if len(s.expired) != maxExpiries {
+		t.Fatalf("Got %d marks, wanted %d", len(s.expired), maxExpiries)
+	}
+	if low, _ := s.expiredBelow("first.test"); low != 0 {
+		t.Fatalf("Oldest mark kept")
+	}
+	if low, _ := s.expiredBelow("group0.test"); low != 3 {
+		t.Fatalf("Mark of group0.test lost")
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// DefaultTLSHandshakeTimeout is the TLS negotiation timeout of servers
+// whose TLSHandshakeTimeout is zero.
+const DefaultTLSHandshakeTimeout = 30 * time.Second
+
+// Serve accepts connections on l and processes each in its own
+// goroutine, until l fails. Temporary accept errors are retried after a
+// delay. Connections from a TLS listener are negotiated first; those
+// failing the negotiation are dropped.
+func (s *Server) Serve(l net.Listener) error {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				slog.Error("Error accepting connection, retrying", "error", err, "delay", delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn negotiates TLS on conn if needed, and processes it.
+func (s *Server) serveConn(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		timeout := s.TLSHandshakeTimeout
+		if timeout == 0 {
+			timeout = DefaultTLSHandshakeTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := tc.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			slog.Debug("TLS negotiation failed, dropping conn", "remote", conn.RemoteAddr(), "error", err)
+			conn.Close()
+			return
+		}
+	}
+	s.Process(conn, ClientSession{})
+}
+
+// ListenAndServeTLS listens on the TCP address addr and serves NNTP over
+// TLS (NNTPS, usually on port 563), where TLS is negotiated before the
+// server greets the client. A nil config stands for s.TLSConfig.
+//
+// Such connections are treated like ones upgraded with STARTTLS, which
+// isn't offered on them.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8143
+func (s *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
+	if config == nil {
+		config = s.TLSConfig
+	}
+	if config == nil {
+		return errors.New("no TLS config")
+	}
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
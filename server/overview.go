@@ -0,0 +1,144 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// An OverviewLine is the overview data of one article, as sent by OVER.
+type OverviewLine struct {
+	Number     int64
+	Subject    string
+	From       string
+	Date       string
+	MessageID  string
+	References string
+	Bytes      int
+	Lines      int
+	// Xref is the content of the Xref header. It is only sent if the
+	// server advertises it in LIST OVERVIEW.FMT (see Server.OverviewXref).
+	Xref string
+	// Header supplies the fields a backend's OverviewSchema lists beyond
+	// the ones above.
+	Header textproto.MIMEHeader
+}
+
+// NewOverviewLine returns the overview data of an article.
+func NewOverviewLine(num int64, a *nntp.Article) *OverviewLine {
+	return &OverviewLine{
+		Number:     num,
+		Subject:    a.Header.Get("Subject"),
+		From:       a.Header.Get("From"),
+		Date:       a.Header.Get("Date"),
+		MessageID:  a.Header.Get("Message-ID"),
+		References: a.Header.Get("References"),
+		Bytes:      a.Bytes,
+		Lines:      a.Lines,
+		Xref:       a.Header.Get("Xref"),
+		Header:     a.Header,
+	}
+}
+
+// overviewField cleans header content for an overview field, in which
+// TAB, CR and LF have to be replaced by spaces.
+func overviewField(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\r', '\n':
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// Line returns the line in the standard overview format, without line
+// ending. The Xref field is included (in full format) only if xref is
+// set.
+func (o *OverviewLine) Line(xref bool) string {
+	f := nntp.DefaultOverviewFmt
+	if xref {
+		f = withXref(f)
+	}
+	return o.Format(f)
+}
+
+// Format returns the line with the fields listed in f, without line
+// ending. Metadata items other than :bytes and :lines are left empty.
+func (o *OverviewLine) Format(f *nntp.OverviewFmt) string {
+	fields := make([]string, 0, len(f.Fields)+1)
+	fields = append(fields, strconv.FormatInt(o.Number, 10))
+	for _, field := range f.Fields {
+		var value string
+		switch strings.ToLower(field.Name) {
+		case "subject":
+			value = o.Subject
+		case "from":
+			value = o.From
+		case "date":
+			value = o.Date
+		case "message-id":
+			value = o.MessageID
+		case "references":
+			value = o.References
+		case "xref":
+			value = o.Xref
+		case ":bytes":
+			value = strconv.Itoa(o.Bytes)
+		case ":lines":
+			value = strconv.Itoa(o.Lines)
+		default:
+			if !strings.HasPrefix(field.Name, ":") {
+				value = o.Header.Get(field.Name)
+			}
+		}
+		// An empty full format field is sent without the header name.
+		if field.Full && value != "" {
+			value = field.Name + ": " + value
+		}
+		fields = append(fields, overviewField(value))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// withXref returns f with the Xref header appended in full format,
+// unless f already lists it.
+func withXref(f *nntp.OverviewFmt) *nntp.OverviewFmt {
+	if f.Index("Xref") >= 0 {
+		return f
+	}
+	n := len(f.Fields)
+	return &nntp.OverviewFmt{Fields: append(f.Fields[:n:n], nntp.OverviewField{Name: "Xref", Full: true})}
+}
@@ -0,0 +1,196 @@
+package nntpserver
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+func TestOverviewLine(t *testing.T) {
+	o := &OverviewLine{Number: 3, Subject: "a\tb", From: "fred", Date: "today",
+		MessageID: "<a@example.com>", Bytes: 10, Lines: 2}
+	if got := o.Line(false); got != "3\ta b\tfred\ttoday\t<a@example.com>\t\t10\t2" {
+		t.Fatalf("Got %q", got)
+	}
+	if got := o.Line(true); !strings.HasSuffix(got, "\t10\t2\t") {
+		t.Fatalf("Empty Xref: got %q", got)
+	}
+	o.Xref = "example.com misc.test:3"
+	if got := o.Line(true); !strings.HasSuffix(got, "\t2\tXref: example.com misc.test:3") {
+		t.Fatalf("Got %q", got)
+	}
+}
+
+// xrefBackend serves a single crossposted article.
+type xrefBackend struct {
+	*testBackend
+}
+
+func (xb *xrefBackend) GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	ch := make(chan NumberedArticle, 1)
+	ch <- NumberedArticle{1, &nntp.Article{
+		Header: textproto.MIMEHeader{
+			"Subject":    {"test"},
+			"Message-Id": {"<a@example.com>"},
+			"Xref":       {"example.com misc.test:1 alt.test:7"},
+		},
+	}}
+	close(ch)
+	return ch, nil
+}
+
+func TestOverXref(t *testing.T) {
+	s := NewServer(&xrefBackend{newTestBackend()}, testIDGen{})
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+
+	cmd(t, c, 215, "LIST OVERVIEW.FMT")
+	fmtLines, _ := c.ReadDotLines()
+	if hasLine(fmtLines, "Xref:full") {
+		t.Fatalf("Xref advertised by default: %q", fmtLines)
+	}
+	cmd(t, c, 224, "OVER 1-1")
+	lines, _ := c.ReadDotLines()
+	if len(lines) != 1 || strings.Contains(lines[0], "Xref") {
+		t.Fatalf("Unexpected overview %q", lines)
+	}
+
+	s.OverviewXref = true
+	cmd(t, c, 215, "LIST OVERVIEW.FMT")
+	fmtLines, _ = c.ReadDotLines()
+	if fmtLines[len(fmtLines)-1] != "Xref:full" {
+		t.Fatalf("Xref not advertised: %q", fmtLines)
+	}
+	cmd(t, c, 224, "OVER 1-1")
+	lines, _ = c.ReadDotLines()
+	if len(lines) != 1 || !strings.HasSuffix(lines[0], "\tXref: example.com misc.test:1 alt.test:7") {
+		t.Fatalf("Unexpected overview %q", lines)
+	}
+}
+
+// schemaBackend advertises an overview format with an extra header.
+type schemaBackend struct {
+	*xrefBackend
+}
+
+func (sb *schemaBackend) OverviewSchema() *nntp.OverviewFmt {
+	fields := append([]nntp.OverviewField{}, nntp.DefaultOverviewFmt.Fields...)
+	return &nntp.OverviewFmt{Fields: append(fields, nntp.OverviewField{Name: "Keywords", Full: true})}
+}
+
+func TestOverviewSchema(t *testing.T) {
+	s := NewServer(&schemaBackend{&xrefBackend{newTestBackend()}}, testIDGen{})
+	s.OverviewXref = true
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+
+	cmd(t, c, 215, "LIST OVERVIEW.FMT")
+	fmtLines, _ := c.ReadDotLines()
+	if len(fmtLines) != 9 || fmtLines[7] != "Keywords:full" || fmtLines[8] != "Xref:full" {
+		t.Fatalf("Unexpected format %q", fmtLines)
+	}
+	cmd(t, c, 224, "OVER 1-1")
+	lines, _ := c.ReadDotLines()
+	if len(lines) != 1 {
+		t.Fatalf("Unexpected overview %q", lines)
+	}
+	// The article has no Keywords header, which leaves the field empty.
+	if fields := strings.Split(lines[0], "\t"); len(fields) != 10 || fields[8] != "" ||
+		fields[9] != "Xref: example.com misc.test:1 alt.test:7" {
+		t.Fatalf("Unexpected overview %q", lines)
+	}
+}
+
+func TestOverviewLineFormat(t *testing.T) {
+	o := NewOverviewLine(3, &nntp.Article{
+		Header: textproto.MIMEHeader{
+			"Subject":  {"a\tb"},
+			"Keywords": {"x, y"},
+		},
+		Bytes: 10,
+	})
+	f := &nntp.OverviewFmt{Fields: []nntp.OverviewField{
+		{Name: "Subject"},
+		{Name: ":bytes"},
+		{Name: "Keywords", Full: true},
+		{Name: ":unknown"},
+	}}
+	if got := o.Format(f); got != "3\ta b\t10\tKeywords: x, y\t" {
+		t.Errorf("Got %q", got)
+	}
+}
+
+func TestOverEmptyGroup(t *testing.T) {
+	tb := newTestBackend()
+	tb.groups["empty.test"] = &nntp.Group{Name: "empty.test", Low: 5, High: 4,
+		Posting: nntp.PostingPermitted}
+	s := NewServer(tb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 412, "OVER 1-10")
+	for _, test := range []struct{ group, over string }{
+		{"empty.test", "OVER 1-10"},
+		{"empty.test", "XOVER 5-"},
+		{"misc.test", "OVER 10-20"},
+	} {
+		cmd(t, c, 211, "GROUP %s", test.group)
+		cmd(t, c, 224, "%s", test.over)
+		if lines, err := c.ReadDotLines(); err != nil || len(lines) != 0 {
+			t.Fatalf("Got %q (%v) for %s in %s, wanted an empty block", lines, err, test.over, test.group)
+		}
+	}
+}
+
+// overBackend has an overview database, and no articles.
+type overBackend struct {
+	*testBackend
+	ranges [][2]int64
+}
+
+func (ob *overBackend) Overview(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan *OverviewLine, error) {
+	ob.ranges = append(ob.ranges, [2]int64{from, to})
+	ch := make(chan *OverviewLine, to-from+1)
+	for n := from; n <= to; n++ {
+		if n != 2 {
+			ch <- &OverviewLine{Number: n, Subject: fmt.Sprint("article ", n)}
+		}
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestOverBackend(t *testing.T) {
+	ob := &overBackend{testBackend: newTestBackend()}
+	s := NewServer(ob, testIDGen{})
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+
+	for _, test := range []struct {
+		cmd      string
+		expected []string
+	}{
+		{"OVER 1-", []string{"1\tarticle 1", "3\tarticle 3", "4\tarticle 4"}},
+		{"XOVER 3", []string{"3\tarticle 3"}},
+		// The current article, set by GROUP.
+		{"OVER", []string{"1\tarticle 1"}},
+	} {
+		cmd(t, c, 224, "%s", test.cmd)
+		lines, err := c.ReadDotLines()
+		if err != nil || len(lines) != len(test.expected) {
+			t.Fatalf("Got %q (%v) for %s", lines, err, test.cmd)
+		}
+		for i, line := range lines {
+			if !strings.HasPrefix(line, test.expected[i]+"\t") {
+				t.Errorf("Got %q for %s, wanted it to start with %q", line, test.cmd, test.expected[i])
+			}
+		}
+	}
+	expected := [][2]int64{{1, 4}, {3, 3}, {1, 1}}
+	if fmt.Sprint(ob.ranges) != fmt.Sprint(expected) {
+		t.Fatalf("Backend asked for %v, wanted %v", ob.ranges, expected)
+	}
+}
@@ -0,0 +1,274 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+)
+
+// ErrAuthFailed is returned when an AUTHINFO exchange fails.
+var ErrAuthFailed = &NNTPError{481, "Authentication failed"}
+
+// ErrAuthAlreadyDone is returned for AUTHINFO after a successful
+// authentication.
+var ErrAuthAlreadyDone = &NNTPError{502, "Already authenticated"}
+
+// ErrUnknownMechanism is returned for AUTHINFO SASL with a mechanism
+// that isn't offered.
+var ErrUnknownMechanism = &NNTPError{503, "Mechanism not supported"}
+
+// ErrBase64 is returned when a SASL response isn't valid base64.
+var ErrBase64 = &NNTPError{504, "Base64 encoding error"}
+
+// A SASLProvider implements the server side of AUTHINFO SASL (RFC 4643).
+type SASLProvider interface {
+	// Mechanisms returns the names of the offered mechanisms, which are
+	// advertised in CAPABILITIES.
+	Mechanisms(session map[string]string) []string
+	// Start begins an exchange using one of the offered mechanisms for
+	// a connection currently served by backend.
+	Start(ctx context.Context, session map[string]string, backend Backend, mechanism string) (SASLExchange, error)
+}
+
+// A SASLExchange is a single SASL authentication exchange.
+type SASLExchange interface {
+	// Next processes a client response and returns either a challenge
+	// for the client, or done once the client is authenticated. The
+	// first response is nil if the client didn't send an initial one.
+	// Any error fails the authentication.
+	Next(response []byte) (challenge []byte, done bool, err error)
+	// Identity returns the authenticated identity once done.
+	Identity() string
+	// Backend returns the backend to use for the rest of the session
+	// once done, or nil to continue using the same backend.
+	Backend() Backend
+}
+
+// BuiltinSASL provides the PLAIN and EXTERNAL mechanisms.
+//
+// PLAIN checks the credentials with the backend's Authenticate method.
+type BuiltinSASL struct {
+	// External returns the identity a client was authenticated as by
+	// external means (e.g. a TLS client certificate), or "" if none.
+	// EXTERNAL is only offered to clients it returns an identity for.
+	External func(session map[string]string) string
+}
+
+// Mechanisms implements SASLProvider.
+func (b *BuiltinSASL) Mechanisms(session map[string]string) []string {
+	if b.External != nil && b.External(session) != "" {
+		return []string{"PLAIN", "EXTERNAL"}
+	}
+	return []string{"PLAIN"}
+}
+
+// Start implements SASLProvider.
+func (b *BuiltinSASL) Start(ctx context.Context, session map[string]string,
+	backend Backend, mechanism string) (SASLExchange, error) {
+
+	switch mechanism {
+	case "PLAIN":
+		return &saslPlain{ctx: ctx, session: session, backend: backend}, nil
+	case "EXTERNAL":
+		if b.External != nil {
+			if identity := b.External(session); identity != "" {
+				return &saslExternal{identity: identity}, nil
+			}
+		}
+	}
+	return nil, ErrUnknownMechanism
+}
+
+// RFC 4616
+type saslPlain struct {
+	ctx      context.Context
+	session  map[string]string
+	backend  Backend
+	identity string
+	result   Backend
+}
+
+func (p *saslPlain) Next(response []byte) ([]byte, bool, error) {
+	if response == nil {
+		return []byte{}, false, nil
+	}
+	parts := bytes.Split(response, []byte{0})
+	if len(parts) != 3 {
+		return nil, false, ErrAuthFailed
+	}
+	authzid, user, pass := string(parts[0]), string(parts[1]), string(parts[2])
+	// Authorizing as someone else isn't supported.
+	if authzid != "" && authzid != user {
+		return nil, false, ErrAuthFailed
+	}
+	b, err := p.backend.Authenticate(p.ctx, p.session, user, pass)
+	if err != nil {
+		return nil, false, err
+	}
+	p.identity = user
+	p.result = b
+	return nil, true, nil
+}
+
+func (p *saslPlain) Identity() string {
+	return p.identity
+}
+
+func (p *saslPlain) Backend() Backend {
+	return p.result
+}
+
+// RFC 4422, Appendix A
+type saslExternal struct {
+	identity string
+}
+
+func (e *saslExternal) Next(response []byte) ([]byte, bool, error) {
+	if response == nil {
+		return []byte{}, false, nil
+	}
+	if e.identity == "" {
+		return nil, false, ErrAuthFailed
+	}
+	if authzid := string(response); authzid != "" && authzid != e.identity {
+		return nil, false, ErrAuthFailed
+	}
+	return nil, true, nil
+}
+
+func (e *saslExternal) Identity() string {
+	return e.identity
+}
+
+func (e *saslExternal) Backend() Backend {
+	return nil
+}
+
+func decodeSASL(s string) ([]byte, error) {
+	if s == "=" {
+		return []byte{}, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBase64
+	}
+	return b, nil
+}
+
+func encodeSASL(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+/*
+Documented outside RFC 3977 --> RFC 4643
+
+Syntax
+
+	AUTHINFO SASL mechanism [initial-response]
+
+Responses
+
+	281             Authentication accepted
+	283 challenge   Authentication accepted (with success data)
+	383 challenge   Continue with SASL exchange
+	481             Authentication failed
+	482             SASL protocol error
+	502             Command unavailable
+	503             Mechanism not supported
+	504             Base64 encoding error
+
+The client cancels the exchange by answering a challenge with "*".
+*/
+func handleAuthInfoSASL(args []string, s *session, c *textproto.Conn) error {
+	provider := s.server.SASL
+	if provider == nil {
+		return ErrSyntax
+	}
+	if s.identity != "" {
+		return ErrAuthAlreadyDone
+	}
+	mechanism := strings.ToUpper(args[1])
+	offered := false
+	for _, m := range provider.Mechanisms(s.clientSession) {
+		offered = offered || m == mechanism
+	}
+	if !offered {
+		return ErrUnknownMechanism
+	}
+
+	var response []byte
+	if len(args) > 2 {
+		var err error
+		response, err = decodeSASL(args[2])
+		if err != nil {
+			return err
+		}
+	}
+	exchange, err := provider.Start(s.ctx, s.clientSession, s.backend, mechanism)
+	if err != nil {
+		return err
+	}
+	for {
+		challenge, done, err := exchange.Next(response)
+		if err != nil {
+			return ErrAuthFailed
+		}
+		if done {
+			s.setIdentity(exchange.Identity())
+			if b := exchange.Backend(); b != nil {
+				s.setBackend(b)
+			}
+			if len(challenge) > 0 {
+				return c.PrintfLine("283 %s", encodeSASL(challenge))
+			}
+			return c.PrintfLine("281 Authentication accepted")
+		}
+		c.PrintfLine("383 %s", encodeSASL(challenge))
+		l, err := c.ReadLine()
+		if err != nil {
+			return err
+		}
+		if l == "*" {
+			return ErrAuthFailed
+		}
+		response, err = decodeSASL(l)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -32,13 +32,18 @@
 package nntpserver
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
+	"net"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kothawoc/go-nntp"
@@ -50,6 +55,26 @@ type NNTPError struct {
 	Msg  string
 }
 
+// ErrTLSRequired is returned for commands that are refused over a
+// connection without TLS.
+var ErrTLSRequired = &NNTPError{483, "Encryption required for this command"}
+
+// ErrTLSUnavailable is returned for STARTTLS if TLS isn't configured,
+// already active, or the client has authenticated.
+var ErrTLSUnavailable = &NNTPError{502, "Command unavailable"}
+
+// ErrNewNewsUnavailable is returned for NEWNEWS if the backend doesn't
+// implement BackendNewNews.
+var ErrNewNewsUnavailable = &NNTPError{502, "NEWNEWS not available"}
+
+// ErrTLSNotPossible is returned for STARTTLS if the connection can't be
+// encrypted.
+var ErrTLSNotPossible = &NNTPError{580, "Can not initiate TLS negotiation"}
+
+// ErrLineTooLong is returned for a command line longer than
+// Server.MaxLineLength.
+var ErrLineTooLong = &NNTPError{500, "Command line too long"}
+
 // ErrNoSuchGroup is returned for a request for a group that can't be found.
 var ErrNoSuchGroup = &NNTPError{411, "No such newsgroup"}
 
@@ -114,6 +139,10 @@ var ErrAuthRejected = &NNTPError{452, "authorization rejected"}
 // authentication, but authentication was not provided.
 var ErrNotAuthenticated = &NNTPError{480, "authentication required"}
 
+// ErrBackendTimeout is returned when a backend call takes longer than
+// the server's BackendTimeout.
+var ErrBackendTimeout = &NNTPError{403, "Backend timed out; try again later"}
+
 // Handler is a low-level protocol handler
 type Handler func(args []string, s *session, c *textproto.Conn) error
 
@@ -124,24 +153,36 @@ type NumberedArticle struct {
 	Article *nntp.Article
 }
 
+// A NumberedHeader is the content of a header of an article, along with
+// the article's number, as sent by HDR.
+type NumberedHeader struct {
+	Num   int64
+	Value string
+}
+
 // The Backend that provides the things and does the stuff.
+//
+// Every method receives a context which is canceled when the client
+// connection ends, and which carries the deadline set by the server's
+// BackendTimeout. Backends without context support can be wrapped with
+// AdaptBackend.
 type Backend interface {
 	// gets a list of NNTP newsgroups.
-	ListGroups(session map[string]string) (<-chan *nntp.Group, error)
-	GetGroup(session map[string]string, name string) (*nntp.Group, error)
+	ListGroups(ctx context.Context, session map[string]string) (<-chan *nntp.Group, error)
+	GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error)
 	// DONE: Add a way for Article Downloading without group select
 	// if not to implement DO: return nil, ErrNoGroupSelected
-	GetArticleWithNoGroup(session map[string]string, id string) (*nntp.Article, error)
-	GetArticle(session map[string]string, group *nntp.Group, id string) (*nntp.Article, error)
+	GetArticleWithNoGroup(ctx context.Context, session map[string]string, id string) (*nntp.Article, error)
+	GetArticle(ctx context.Context, session map[string]string, group *nntp.Group, id string) (*nntp.Article, error)
 	// old: GetArticles(group *nntp.Group, from, to int64) ([]NumberedArticle, error)
 	// channels are more suitable for large scale
-	GetArticles(session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error)
-	Authorized(session map[string]string) bool
+	GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error)
+	Authorized(ctx context.Context, session map[string]string) bool
 	// Authenticate and optionally swap out the backend for this session.
 	// You may return nil to continue using the same backend.
-	Authenticate(session map[string]string, user, pass string) (Backend, error)
-	AllowPost(session map[string]string) bool
-	Post(session map[string]string, article *nntp.Article) error
+	Authenticate(ctx context.Context, session map[string]string, user, pass string) (Backend, error)
+	AllowPost(ctx context.Context, session map[string]string) bool
+	Post(ctx context.Context, session map[string]string, article *nntp.Article) error
 }
 
 // An optional Interface Backend-objects may provide.
@@ -157,7 +198,7 @@ type BackendIHave interface {
 	//
 	// If BackendIHave is not provided, the server will use the Post-method with
 	// any ErrPostingFailed-result being replaced by ErrIHaveFailed automatically.
-	IHave(session map[string]string, id string, article *nntp.Article) error
+	IHave(ctx context.Context, session map[string]string, id string, article *nntp.Article) error
 
 	// This method will tell the server frontent, and thus, the client, wether the server should
 	// accept the Article or not.
@@ -167,7 +208,7 @@ type BackendIHave interface {
 	//
 	// If BackendIHave is not provided, the server will use the method
 	// GetArticleWithNoGroup-method to determine.
-	IHaveWantArticle(session map[string]string, id string) error
+	IHaveWantArticle(ctx context.Context, session map[string]string, id string) error
 }
 
 // An optional Interface Backend-objects may provide.
@@ -180,7 +221,107 @@ type BackendListWildMat interface {
 	// This function will be called instead of ListGroups, if the
 	// WildMat parameter is given. The implementor must return at
 	// least all groups, that matches the given pattern.
-	ListGroupsWildMat(session map[string]string, pattern *WildMat) (<-chan *nntp.Group, error)
+	ListGroupsWildMat(ctx context.Context, session map[string]string, pattern *WildMat) (<-chan *nntp.Group, error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface lets the GROUP command be answered from cheap
+// estimates, which matters for very large groups where GetGroup would
+// have to count every article.
+type BackendGroupEstimate interface {
+	// GroupEstimate returns the estimated number of articles and the
+	// low and high water marks of a group, or ErrNoSuchGroup.
+	//
+	// As per RFC 3977, for a non-empty group the count must be no less
+	// than the number of articles actually available and no greater
+	// than high-low+1. For an empty group, the count should be 0 and
+	// low should be greater than high.
+	//
+	// When this interface is provided, the group selected by GROUP
+	// (and passed to later backend calls) only carries the name and
+	// these three numbers. The posting status and description are
+	// kept when the group is already selected, e.g. by LISTGROUP,
+	// and otherwise left empty.
+	//
+	// LISTGROUP with a group argument still calls GetGroup, so its
+	// numbers may differ from those reported by GROUP.
+	GroupEstimate(ctx context.Context, session map[string]string, name string) (count, low, high int64, err error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface adds a per-group check to POST, on top of the posting
+// status of the groups.
+type BackendPostGroup interface {
+	// AllowPostGroup tells whether the client may post to a group the
+	// article is crossposted to. If it may not be posted to any of
+	// them, the article is rejected.
+	AllowPostGroup(ctx context.Context, session map[string]string, group *nntp.Group) bool
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface lets a backend advertise the fields its overview
+// database actually holds, instead of the seven fields required by
+// RFC 3977.
+type BackendOverviewSchema interface {
+	// OverviewSchema returns the overview format listed by LIST
+	// OVERVIEW.FMT, which OVER then follows. Clients generally expect
+	// it to start with the seven standard fields, in order (RFC 3977,
+	// section 8.4). A nil result selects the standard format.
+	OverviewSchema() *nntp.OverviewFmt
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface lets OVER be answered from an overview database,
+// rather than from the articles returned by GetArticles.
+type BackendOverview interface {
+	// Overview returns the overview data of the existing articles of a
+	// group numbered from "from" to "to", in ascending order. The
+	// channel is read until it is closed.
+	Overview(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan *OverviewLine, error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface lets LISTGROUP, NEXT and LAST find the existing
+// articles of a group without retrieving them.
+type BackendArticleNumbers interface {
+	// ArticleNumbers returns the numbers of the existing articles of a
+	// group from "from" to "to", in ascending order.
+	ArticleNumbers(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) ([]int64, error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface lets HDR be answered without retrieving the articles.
+type BackendHeader interface {
+	// GetHeader returns the content of a header, or of the metadata
+	// items :bytes and :lines, for the existing articles of a group
+	// from "from" to "to", in ascending order. Articles without the
+	// header are listed with an empty value.
+	GetHeader(ctx context.Context, session map[string]string, group *nntp.Group, header string, from, to int64) ([]NumberedHeader, error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface answers NEWNEWS from an index by arrival time; without
+// it, NEWNEWS isn't available.
+type BackendNewNews interface {
+	// NewNews returns the message-ids of the articles posted to groups
+	// matching wildmat since the given time.
+	NewNews(ctx context.Context, session map[string]string, wildmat *nntp.Wildmat, since time.Time) ([]string, error)
+}
+
+// An optional Interface Backend-objects may provide.
+//
+// This interface provides the groups listed by NEWGROUPS, which is
+// otherwise answered with an empty list.
+type BackendNewGroups interface {
+	// NewGroups returns the groups created since the given time.
+	NewGroups(ctx context.Context, session map[string]string, since time.Time) ([]*nntp.Group, error)
 }
 
 type IdGenerator interface {
@@ -189,7 +330,24 @@ type IdGenerator interface {
 
 type ClientSession map[string]string
 
+// IdentityKey is the ClientSession key under which the server stores the
+// identity a client authenticated as, for use in backend ACL checks.
+const IdentityKey = "identity"
+
+type identityContextKey struct{}
+
+// IdentityFromContext returns the identity the client authenticated as,
+// from the context passed to backend calls, or "" before
+// authentication. Backends may use it e.g. to record the poster of an
+// article.
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityContextKey{}).(string)
+	return identity
+}
+
 type session struct {
+	ctx           context.Context
+	cmdCtx        context.Context
 	server        *Server
 	backend       Backend
 	idGenerator   IdGenerator
@@ -197,13 +355,65 @@ type session struct {
 	number        int64
 	beIhave       BackendIHave
 	beWildMat     BackendListWildMat
+	beEstimate    BackendGroupEstimate
+	bePostGroup   BackendPostGroup
+	beOverview    BackendOverviewSchema
+	beOver        BackendOverview
+	beNumbers     BackendArticleNumbers
+	beHeader      BackendHeader
+	beNewNews     BackendNewNews
+	beNewGroups   BackendNewGroups
+	groupSelected time.Time
+	conn          io.ReadWriteCloser
+	text          *textproto.Conn
+	tls           bool
+	identity      string
 	clientSession ClientSession
+	// log carries the identity, once authenticated.
+	log *slog.Logger
 }
 
 func (s *session) setBackend(backend Backend) {
 	s.backend = backend
 	s.beIhave, _ = backend.(BackendIHave)
 	s.beWildMat, _ = backend.(BackendListWildMat)
+	s.beEstimate, _ = backend.(BackendGroupEstimate)
+	s.bePostGroup, _ = backend.(BackendPostGroup)
+	s.beOverview, _ = backend.(BackendOverviewSchema)
+	s.beOver, _ = backend.(BackendOverview)
+	s.beNumbers, _ = backend.(BackendArticleNumbers)
+	s.beHeader, _ = backend.(BackendHeader)
+	s.beNewNews, _ = backend.(BackendNewNews)
+	s.beNewGroups, _ = backend.(BackendNewGroups)
+	if a, ok := backend.(*simpleBackendAdapter); ok {
+		a.setOptional(s)
+	}
+}
+
+// overviewFmt returns the overview format of the backend, with the Xref
+// header added if the server is configured to send it.
+func (s *session) overviewFmt() *nntp.OverviewFmt {
+	f := nntp.DefaultOverviewFmt
+	if s.beOverview != nil {
+		if schema := s.beOverview.OverviewSchema(); schema != nil {
+			f = schema
+		}
+	}
+	if s.server.OverviewXref {
+		f = withXref(f)
+	}
+	return f
+}
+
+// setIdentity records the identity the client authenticated as in the
+// session, the context of later backend calls and the session's log
+// messages. It's only called once, as AUTHINFO is refused after
+// authentication.
+func (s *session) setIdentity(identity string) {
+	s.identity = identity
+	s.ctx = context.WithValue(s.ctx, identityContextKey{}, identity)
+	s.clientSession[IdentityKey] = identity
+	s.log = slog.Default().With("identity", identity)
 }
 
 // The Server handle.
@@ -216,8 +426,65 @@ type Server struct {
 	IdGenerator IdGenerator
 	// The currently selected group.
 	group *nntp.Group
+	// BackendTimeout bounds the duration of a single backend lookup
+	// (zero means no limit). The client receives a 403 response when a
+	// lookup exceeds it, independently of any network timeouts.
+	BackendTimeout time.Duration
+	// SASL, if set, enables AUTHINFO SASL.
+	SASL SASLProvider
+	// OverviewXref adds the Xref header to the overview data, which
+	// readers use to mark crossposted articles read in every group.
+	OverviewXref bool
+	// GroupCacheTTL lets GROUP for the currently selected group reuse
+	// the numbers looked up at most this long ago, rather than asking
+	// the backend again (zero means always asking).
+	GroupCacheTTL time.Duration
+	// RequireTLSForPost refuses POST, IHAVE, CHECK and TAKETHIS over
+	// connections without TLS with a 483 response.
+	RequireTLSForPost bool
+	// RequireTLSForAuth likewise refuses AUTHINFO.
+	RequireTLSForAuth bool
+	// TLSConfig, if set, enables STARTTLS.
+	TLSConfig *tls.Config
+	// MaxLineLength is the longest command line accepted, excluding
+	// the line ending (DefaultMaxLineLength if zero). Longer lines are
+	// discarded as they are read and answered with 500.
+	MaxLineLength int
+	// HelpText is appended to the command list sent for HELP, e.g. to
+	// state posting rules or contact details.
+	HelpText string
+	// RequiredHeaders are the headers POST and IHAVE check articles
+	// for, before passing them to the backend (nntp.RequiredPostHeaders
+	// if nil). An empty, non-nil slice disables the check.
+	RequiredHeaders []string
+	// MaxConnsPerIP limits the number of simultaneous connections from
+	// a single IP address (zero means no limit). Further connections are
+	// greeted with 400 and closed.
+	MaxConnsPerIP int
+	// TrustedPeer, if set, exempts the addresses it returns true for
+	// from MaxConnsPerIP, e.g. feeding peers.
+	TrustedPeer func(ip net.IP) bool
+	// Now, if set, replaces time.Now as the clock reported by DATE and
+	// used for the two-digit years of NEWGROUPS and NEWNEWS.
+	Now func() time.Time
+	// TLSHandshakeTimeout bounds the TLS negotiation of connections
+	// accepted by Serve from a TLS listener, so that clients that stall
+	// it don't hold on to their connection (zero means
+	// DefaultTLSHandshakeTimeout).
+	TLSHandshakeTimeout time.Duration
+
+	// Set by ArticlesExpired.
+	expiryMu sync.Mutex
+	expired  map[string]expiry
+	// Connections counted for MaxConnsPerIP, by IP address.
+	connsMu sync.Mutex
+	conns   map[string]int
 }
 
+// DefaultMaxLineLength is the default for Server.MaxLineLength. RFC 3977
+// limits command lines to 512 octets, but some clients exceed that.
+const DefaultMaxLineLength = 4096
+
 // NewServer builds a new server handle request to a backend.
 func NewServer(backend Backend, idGenerator IdGenerator) *Server {
 	rv := Server{
@@ -240,6 +507,7 @@ func NewServer(backend Backend, idGenerator IdGenerator) *Server {
 	rv.Handlers["mode"] = handleMode
 	rv.Handlers["authinfo"] = handleAuthInfo
 	rv.Handlers["newgroups"] = handleNewGroups
+	rv.Handlers["newnews"] = handleNewNews
 	rv.Handlers["over"] = handleOver
 	rv.Handlers["xover"] = handleOver
 	rv.Handlers["hdr"] = handleHdr
@@ -250,9 +518,18 @@ func NewServer(backend Backend, idGenerator IdGenerator) *Server {
 	rv.Handlers["stat"] = handleStat
 	rv.Handlers["help"] = handleHelp
 	rv.Handlers["date"] = handleDate
+	rv.Handlers["starttls"] = handleStartTLS
 	return &rv
 }
 
+// now returns the current time according to s.Now.
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
 func (e *NNTPError) Error() string {
 	return fmt.Sprintf("%d %s", e.Code, e.Msg)
 }
@@ -267,6 +544,11 @@ func (s *session) dispatchCommand(cmd string, args []string,
 			panic("No default handler.")
 		}
 	}
+	// Streams returned by the backend may be produced until the
+	// command is done.
+	var cancel context.CancelFunc
+	s.cmdCtx, cancel = context.WithCancel(s.ctx)
+	defer cancel()
 	return handler(args, s, c)
 }
 
@@ -274,6 +556,11 @@ func (s *session) dispatchCommand(cmd string, args []string,
 func (s *Server) Process(tc io.ReadWriteCloser, clientSession ClientSession) {
 	defer tc.Close()
 	c := textproto.NewConn(tc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if clientSession == nil {
+		clientSession = ClientSession{}
+	}
 
 	var backend Backend
 	if s.Backend != nil {
@@ -283,24 +570,46 @@ func (s *Server) Process(tc io.ReadWriteCloser, clientSession ClientSession) {
 	}
 
 	sess := &session{
+		ctx:           ctx,
+		conn:          tc,
+		text:          c,
 		server:        s,
 		idGenerator:   s.IdGenerator,
 		group:         nil,
 		number:        0,
 		clientSession: clientSession,
+		log:           slog.Default(),
 	}
+	_, sess.tls = tc.(*tls.Conn)
 	sess.setBackend(backend)
-	slog.Debug("id gen test", "idgen", s.IdGenerator.GenID())
+
+	ip, ok := s.acquireConn(tc)
+	if !ok {
+		sess.log.Info("Too many connections, dropping conn", "ip", ip)
+		c.PrintfLine("400 Too many connections from your address")
+		return
+	}
+	defer s.releaseConn(ip)
 
 	c.PrintfLine("200 Hello!")
 	for {
-		l, err := c.ReadLine()
+		// STARTTLS replaces the connection.
+		c = sess.text
+		maxLine := s.MaxLineLength
+		if maxLine <= 0 {
+			maxLine = DefaultMaxLineLength
+		}
+		l, err := readLimitedLine(c.R, maxLine)
+		if err == ErrLineTooLong {
+			c.PrintfLine(err.Error())
+			continue
+		}
 		if err != nil {
-			slog.Error("Error reading from client, dropping conn", "error", err)
+			sess.log.Error("Error reading from client, dropping conn", "error", err)
 			return
 		}
 		cmd := strings.Split(l, " ")
-		slog.Debug("Got cmd", "cmd", cmd)
+		sess.log.Debug("Got cmd", "cmd", cmd)
 		args := []string{}
 		if len(cmd) > 1 {
 			args = cmd[1:]
@@ -311,18 +620,208 @@ func (s *Server) Process(tc io.ReadWriteCloser, clientSession ClientSession) {
 			switch {
 			case err == io.EOF:
 				// Drop this connection silently. They hung up
-				slog.Debug("Error dispatching command, dropping conn", "error", err)
+				sess.log.Debug("Error dispatching command, dropping conn", "error", err)
 				return
 			case isNNTPError:
 				c.PrintfLine(err.Error())
 			default:
-				slog.Debug("Error dispatching command, dropping conn", "error", err)
+				sess.log.Debug("Error dispatching command, dropping conn", "error", err)
 				return
 			}
 		}
 	}
 }
 
+// callBackend runs a backend operation bounded by the server's
+// BackendTimeout. If the operation doesn't return in time, its context
+// is canceled, the timeout is logged and ErrBackendTimeout is returned;
+// its eventual result is discarded.
+//
+// Only the call itself is bounded: a channel it returns may be filled
+// until the current command is done, which is when the context passed
+// to the backend is canceled.
+//
+// Operations that read from the client connection must not be run
+// through callBackend.
+func callBackend[T any](s *session, op string, f func(ctx context.Context) (T, error)) (T, error) {
+	timeout := s.server.BackendTimeout
+	if timeout <= 0 {
+		return f(s.cmdCtx)
+	}
+	ctx, cancel := context.WithCancel(s.cmdCtx)
+	timer := time.AfterFunc(timeout, cancel)
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := f(ctx)
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		if timer.Stop() {
+			return r.v, r.err
+		}
+		// The timeout fired as the call returned.
+		discardResult(r.v)
+	case <-ctx.Done():
+		go func() {
+			discardResult((<-done).v)
+		}()
+	}
+	s.log.Error("Backend operation timed out", "op", op, "timeout", timeout)
+	var zero T
+	return zero, ErrBackendTimeout
+}
+
+// discardResult drains a channel returned by an abandoned backend call,
+// so the backend's producer can finish.
+func discardResult(v interface{}) {
+	switch ch := v.(type) {
+	case <-chan NumberedArticle:
+		for range ch {
+		}
+	case <-chan *nntp.Group:
+		for range ch {
+		}
+	case <-chan *OverviewLine:
+		for range ch {
+		}
+	}
+}
+
+func (s *session) lookupGroup(name string) (*nntp.Group, error) {
+	return callBackend(s, "GetGroup", func(ctx context.Context) (*nntp.Group, error) {
+		return s.backend.GetGroup(ctx, s.clientSession, name)
+	})
+}
+
+// estimateGroup looks up a group for GROUP, preferring the backend's
+// estimates when available. Estimates don't include the posting status
+// and description, which are taken from the selected group if it's the
+// same.
+func (s *session) estimateGroup(name string) (*nntp.Group, error) {
+	if s.beEstimate == nil {
+		return s.lookupGroup(name)
+	}
+	g, err := callBackend(s, "GroupEstimate", func(ctx context.Context) (*nntp.Group, error) {
+		count, low, high, err := s.beEstimate.GroupEstimate(ctx, s.clientSession, name)
+		if err != nil {
+			return nil, err
+		}
+		return &nntp.Group{Name: name, Count: count, Low: low, High: high}, nil
+	})
+	if err == nil && s.group != nil && s.group.Name == name {
+		g.Posting = s.group.Posting
+		g.Description = s.group.Description
+	}
+	return g, err
+}
+
+func (s *session) listGroups(wildmat *WildMat) (<-chan *nntp.Group, error) {
+	return callBackend(s, "ListGroups", func(ctx context.Context) (<-chan *nntp.Group, error) {
+		if wildmat != nil && s.beWildMat != nil {
+			return s.beWildMat.ListGroupsWildMat(ctx, s.clientSession, wildmat)
+		}
+		return s.backend.ListGroups(ctx, s.clientSession)
+	})
+}
+
+func (s *session) lookupArticle(group *nntp.Group, id string) (*nntp.Article, error) {
+	return callBackend(s, "GetArticle", func(ctx context.Context) (*nntp.Article, error) {
+		return s.backend.GetArticle(ctx, s.clientSession, group, id)
+	})
+}
+
+func (s *session) lookupArticleNoGroup(id string) (*nntp.Article, error) {
+	return callBackend(s, "GetArticleWithNoGroup", func(ctx context.Context) (*nntp.Article, error) {
+		return s.backend.GetArticleWithNoGroup(ctx, s.clientSession, id)
+	})
+}
+
+func (s *session) lookupArticles(group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	return callBackend(s, "GetArticles", func(ctx context.Context) (<-chan NumberedArticle, error) {
+		return s.backend.GetArticles(ctx, s.clientSession, group, from, to)
+	})
+}
+
+// lookupOverview returns the overview data of the articles of a group
+// numbered from "from" to "to", from the backend's overview database if it
+// has one, or else from the articles themselves.
+func (s *session) lookupOverview(group *nntp.Group, from, to int64) (<-chan *OverviewLine, error) {
+	if s.beOver != nil {
+		return callBackend(s, "Overview", func(ctx context.Context) (<-chan *OverviewLine, error) {
+			return s.beOver.Overview(ctx, s.clientSession, group, from, to)
+		})
+	}
+	articles, err := s.lookupArticles(group, from, to)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(chan *OverviewLine)
+	go func() {
+		defer close(lines)
+		for a := range articles {
+			lines <- NewOverviewLine(a.Num, a.Article)
+		}
+	}()
+	return lines, nil
+}
+
+// lookupArticleNumbers returns the numbers of the existing articles of a
+// group from "from" to "to", taken from GetArticles unless the backend
+// provides BackendArticleNumbers.
+func (s *session) lookupArticleNumbers(group *nntp.Group, from, to int64) ([]int64, error) {
+	if s.beNumbers != nil {
+		return callBackend(s, "ArticleNumbers", func(ctx context.Context) ([]int64, error) {
+			return s.beNumbers.ArticleNumbers(ctx, s.clientSession, group, from, to)
+		})
+	}
+	articles, err := s.lookupArticles(group, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var nums []int64
+	for a := range articles {
+		nums = append(nums, a.Num)
+	}
+	return nums, nil
+}
+
+// lookupHeader returns the content of a header for the existing articles
+// of a group from "from" to "to", taken from GetArticles unless the
+// backend provides BackendHeader.
+func (s *session) lookupHeader(group *nntp.Group, header string, from, to int64) ([]NumberedHeader, error) {
+	if s.beHeader != nil {
+		return callBackend(s, "GetHeader", func(ctx context.Context) ([]NumberedHeader, error) {
+			return s.beHeader.GetHeader(ctx, s.clientSession, group, header, from, to)
+		})
+	}
+	articles, err := s.lookupArticles(group, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var headers []NumberedHeader
+	for a := range articles {
+		headers = append(headers, NumberedHeader{a.Num, headerValue(a.Article, header)})
+	}
+	return headers, nil
+}
+
+// headerValue returns the content of a header of an article, or of the
+// metadata items :bytes and :lines, as sent by HDR.
+func headerValue(a *nntp.Article, header string) string {
+	switch strings.ToLower(header) {
+	case ":bytes":
+		return strconv.Itoa(a.Bytes)
+	case ":lines":
+		return strconv.Itoa(a.Lines)
+	}
+	return a.Header.Get(header)
+}
+
 func parseRange(spec string) (low, high int64) {
 	if spec == "" {
 		return 0, math.MaxInt64
@@ -332,11 +831,12 @@ func parseRange(spec string) (low, high int64) {
 		return 0, math.MaxInt64
 	}
 	if len(parts) == 1 {
-		h, err := strconv.ParseInt(parts[0], 10, 64)
+		// A single article.
+		n, err := strconv.ParseInt(parts[0], 10, 64)
 		if err != nil {
-			h = math.MaxInt64
+			return 0, math.MaxInt64
 		}
-		return 0, h
+		return n, n
 	}
 	l, _ := strconv.ParseInt(parts[0], 10, 64)
 	h, err := strconv.ParseInt(parts[1], 10, 64)
@@ -368,6 +868,14 @@ Parameters
 	high      Reported high water mark
 
 [1] The 412 response can only occur if no group has been specified.
+
+Unless it names the currently selected group, the group is looked up
+with GetGroup, even if the backend provides BackendGroupEstimate.
+
+Like GROUP, it selects the group and sets the current article pointer
+to its first article. A group it looks up counts as just looked up for
+Server.GroupCacheTTL. The numbers come from BackendArticleNumbers when
+the backend provides it.
 */
 func handleListgroup(args []string, s *session, c *textproto.Conn) error {
 	grp := s.group
@@ -379,34 +887,50 @@ func handleListgroup(args []string, s *session, c *textproto.Conn) error {
 	if len(args) > 1 {
 		arg1 = args[1]
 	}
-	if arg0 != "" {
-		ok := false
-		if grp != nil {
-			ok = grp.Name == arg0
-		}
-		if grp == nil || !ok {
-			var err error
-			grp, err = s.backend.GetGroup(s.clientSession, args[0])
-			if err != nil {
-				return err
-			}
+	lookedUp := false
+	if arg0 != "" && (grp == nil || grp.Name != arg0) {
+		var err error
+		grp, err = s.lookupGroup(arg0)
+		if err != nil {
+			return err
 		}
+		lookedUp = true
 	}
 	if grp == nil {
 		return ErrNoGroupSelected
 	}
 
+	// Only ask the backend for numbers that can exist.
 	from, to := parseRange(arg1)
-	articles, err := s.backend.GetArticles(s.clientSession, grp, from, to)
-	if err != nil {
-		return err
+	from = max(from, grp.Low)
+	to = min(to, grp.High)
+	var nums []int64
+	if from <= to {
+		var err error
+		nums, err = s.lookupArticleNumbers(grp, from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.group = grp
+	if lookedUp {
+		s.groupSelected = time.Now()
+	}
+	s.number = -1
+	if grp.Count > 0 && grp.Low <= grp.High {
+		s.number = grp.Low
 	}
 
 	c.PrintfLine("211 %d %d %d %s", grp.Count, grp.Low, grp.High, grp.Name)
+	if len(nums) == 0 {
+		// An unused DotWriter would send an empty line.
+		return c.PrintfLine(".")
+	}
 	dw := c.DotWriter()
 	defer dw.Close()
-	for a := range articles {
-		fmt.Fprintf(dw, "%d\n", a.Num)
+	for _, n := range nums {
+		fmt.Fprintf(dw, "%d\n", n)
 	}
 	return nil
 }
@@ -428,7 +952,9 @@ Indicating capability: OVER
    Second form (range specified)
      224    Overview information follows (multi-line)
      412    No newsgroup selected
-     423    No articles in that range
+
+   A range without articles, e.g. in an empty group, gets an empty 224
+   block rather than 423, as XOVER clients expect.
 
    Third form (current article number used)
      224    Overview information follows (multi-line)
@@ -438,6 +964,8 @@ Indicating capability: OVER
    Parameters
      range         Number(s) of articles
      message-id    Message-id of article
+
+   The data comes from BackendOverview when the backend provides it.
 */
 /*
    "0" or article number (see below)
@@ -448,54 +976,61 @@ Indicating capability: OVER
    References header content
    :bytes metadata item
    :lines metadata item
+   further fields of the backend's OverviewSchema, if any
+   Xref header content, in full format (only with Server.OverviewXref)
 */
 func handleOver(args []string, s *session, c *textproto.Conn) error {
 	arg0 := ""
 	if len(args) > 0 {
 		arg0 = args[0]
 	}
-	single, nogroup := analiyzeArticleID(arg0)
-	if s.group == nil && !nogroup {
-		return ErrNoGroupSelected
-	}
-	if single {
-		var a *nntp.Article
-		var e error
-		if nogroup {
-			a, e = s.backend.GetArticleWithNoGroup(s.clientSession, arg0)
-		} else {
-			a, e = s.backend.GetArticle(s.clientSession, s.group, arg0)
+	if _, nogroup := analiyzeArticleID(arg0); nogroup {
+		a, err := s.lookupArticleNoGroup(arg0)
+		if err == ErrInvalidArticleNumber || (err == nil && a == nil) {
+			err = ErrInvalidMessageID
 		}
-		if e != nil {
-			return e
+		if err != nil {
+			return err
 		}
+		c.PrintfLine("224 here it comes")
 		dw := c.DotWriter()
 		defer dw.Close()
-		fmt.Fprintf(dw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", 0,
-			a.Header.Get("Subject"),
-			a.Header.Get("From"),
-			a.Header.Get("Date"),
-			a.Header.Get("Message-ID"),
-			a.Header.Get("References"),
-			a.Bytes, a.Lines)
+		fmt.Fprintln(dw, NewOverviewLine(0, a).Format(s.overviewFmt()))
 		return nil
 	}
-	from, to := parseRange(arg0)
-	articles, err := s.backend.GetArticles(s.clientSession, s.group, from, to)
-	if err != nil {
-		return err
+	if s.group == nil {
+		return ErrNoGroupSelected
+	}
+	var from, to int64
+	if arg0 == "" {
+		if s.number < 0 || s.number > s.group.High || s.isExpired(s.number) {
+			return ErrNoCurrentArticle
+		}
+		from, to = s.number, s.number
+	} else {
+		from, to = parseRange(arg0)
+	}
+	// Only ask the backend for numbers that can exist.
+	from = max(from, s.group.Low)
+	to = min(to, s.group.High)
+	var lines <-chan *OverviewLine
+	if from <= to {
+		var err error
+		lines, err = s.lookupOverview(s.group, from, to)
+		if err != nil {
+			return err
+		}
 	}
 	c.PrintfLine("224 here it comes")
+	if lines == nil {
+		// An unused DotWriter would send an empty line.
+		return c.PrintfLine(".")
+	}
 	dw := c.DotWriter()
 	defer dw.Close()
-	for a := range articles {
-		fmt.Fprintf(dw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", a.Num,
-			a.Article.Header.Get("Subject"),
-			a.Article.Header.Get("From"),
-			a.Article.Header.Get("Date"),
-			a.Article.Header.Get("Message-ID"),
-			a.Article.Header.Get("References"),
-			a.Article.Bytes, a.Article.Lines)
+	f := s.overviewFmt()
+	for o := range lines {
+		fmt.Fprintln(dw, o.Format(f))
 	}
 	return nil
 }
@@ -511,41 +1046,19 @@ Responses
 
 	215    Information follows (multi-line)
 */
-func handleListOverviewFmt(dw io.Writer, c *textproto.Conn) error {
+func handleListOverviewFmt(s *session, c *textproto.Conn) error {
 	err := c.PrintfLine("215 Information follows")
 	if err != nil {
 		return err
 	}
-	// This is NOT a performance critical function
-	_, err = fmt.Fprintln(dw, "Subject:")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, "From:")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, "Date:")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, "Message-ID:")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, "References:")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, ":bytes")
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(dw, ":lines")
-	if err != nil {
-		return err
+	// The dot writer must only be opened after the status line.
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, line := range s.overviewFmt().Lines() {
+		if _, err = fmt.Fprintln(dw, line); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
@@ -582,67 +1095,67 @@ Parameters
 	field         Name of field
 	range         Number(s) of articles
 	message-id    Message-id of article
+
+Each line holds the article number and the field content, separated by
+a space. The contents come from BackendHeader when the backend provides
+it.
 */
 func handleHdr(args []string, s *session, c *textproto.Conn) error {
-	arg0 := ""
-	arg1 := ""
-	if len(args) > 0 {
-		arg0 = args[0]
+	if len(args) < 1 {
+		return ErrSyntax
 	}
+	field := args[0]
+	arg1 := ""
 	if len(args) > 1 {
 		arg1 = args[1]
 	}
-	single, nogroup := analiyzeArticleID(arg1)
-	if s.group == nil && !nogroup {
-		return ErrNoGroupSelected
-	}
-	if single {
-		var a *nntp.Article
-		var e error
-		if nogroup {
-			a, e = s.backend.GetArticleWithNoGroup(s.clientSession, arg1)
-		} else {
-			a, e = s.backend.GetArticle(s.clientSession, s.group, arg1)
+	if _, nogroup := analiyzeArticleID(arg1); nogroup {
+		a, err := s.lookupArticleNoGroup(arg1)
+		if err == ErrInvalidArticleNumber || (err == nil && a == nil) {
+			err = ErrInvalidMessageID
 		}
-		if e != nil {
-			return e
+		if err != nil {
+			return err
 		}
+		c.PrintfLine("225 Headers follow")
 		dw := c.DotWriter()
 		defer dw.Close()
-		switch arg0 {
-		case ":bytes":
-			fmt.Fprintf(dw, "%d\t%d\n", 0, a.Bytes)
-		case ":lines":
-			fmt.Fprintf(dw, "%d\t%d\n", 0, a.Lines)
-		default:
-			fmt.Fprintf(dw, "%d\t%s\n", 0, a.Header.Get(arg0))
-		}
+		fmt.Fprintf(dw, "0 %s\n", overviewField(headerValue(a, field)))
 		return nil
 	}
-
-	from, to := parseRange(arg1)
-	articles, err := s.backend.GetArticles(s.clientSession, s.group, from, to)
-	if err != nil {
-		return err
+	if s.group == nil {
+		return ErrNoGroupSelected
 	}
-	c.PrintfLine("224 here it comes")
-	dw := c.DotWriter()
-	defer dw.Close()
-	switch arg0 {
-	case ":bytes":
-		for a := range articles {
-			fmt.Fprintf(dw, "%d\t%d\n", a.Num, a.Article.Bytes)
+	var from, to int64
+	if arg1 == "" {
+		if s.number < 0 || s.number > s.group.High || s.isExpired(s.number) {
+			return ErrNoCurrentArticle
 		}
-	case ":lines":
-		for a := range articles {
-			fmt.Fprintf(dw, "%d\t%d\n", a.Num, a.Article.Lines)
-		}
-	default:
-		for a := range articles {
-			fmt.Fprintf(dw, "%d\t%s\n", a.Num,
-				a.Article.Header.Get(arg0))
+		from, to = s.number, s.number
+	} else {
+		from, to = parseRange(arg1)
+	}
+	// Only ask the backend for numbers that can exist.
+	from = max(from, s.group.Low)
+	to = min(to, s.group.High)
+	var headers []NumberedHeader
+	if from <= to {
+		var err error
+		headers, err = s.lookupHeader(s.group, field, from, to)
+		if err != nil {
+			return err
 		}
 	}
+	c.PrintfLine("225 Headers follow")
+	if len(headers) == 0 {
+		// An unused DotWriter would send an empty line.
+		return c.PrintfLine(".")
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, h := range headers {
+		fmt.Fprintf(dw, "%d %s\n", h.Num, overviewField(h.Value))
+	}
 	return nil
 }
 
@@ -718,9 +1231,7 @@ func handleList(args []string, s *session, c *textproto.Conn) error {
 	}
 
 	if ltype == "overview.fmt" {
-		dw := c.DotWriter()
-		defer dw.Close()
-		return handleListOverviewFmt(dw, c)
+		return handleListOverviewFmt(s, c)
 	} else if ltype == "headers" {
 		dw := c.DotWriter()
 		defer dw.Close()
@@ -734,14 +1245,7 @@ func handleList(args []string, s *session, c *textproto.Conn) error {
 			return ErrSyntax
 		}
 	}
-	var err error
-	var groups <-chan *nntp.Group
-
-	if wildmat != nil && s.beWildMat != nil {
-		groups, err = s.beWildMat.ListGroupsWildMat(s.clientSession, wildmat)
-	} else {
-		groups, err = s.backend.ListGroups(s.clientSession)
-	}
+	groups, err := s.listGroups(wildmat)
 	if err != nil {
 		return err
 	}
@@ -756,8 +1260,7 @@ func handleList(args []string, s *session, c *textproto.Conn) error {
 		}
 		switch ltype {
 		case "active":
-			fmt.Fprintf(dw, "%s %d %d %v\r\n",
-				g.Name, g.High, g.Low, g.Posting)
+			fmt.Fprintln(dw, g)
 		case "newsgroups":
 			fmt.Fprintf(dw, "%s %s\r\n", g.Name, g.Description)
 		}
@@ -790,10 +1293,88 @@ the LIST ACTIVE command (see Section 7.6.3).  However, they MAY
 include groups not available on the server (and so not returned by
 LIST ACTIVE) and MAY omit groups for which the creation date is not
 available.
+
+The groups come from BackendNewGroups; without it, the list is empty.
 */
 func handleNewGroups(args []string, s *session, c *textproto.Conn) error {
+	since, err := parseDateTime(args, s.server.now())
+	if err != nil {
+		return err
+	}
+	var groups []*nntp.Group
+	if s.beNewGroups != nil {
+		groups, err = callBackend(s, "NewGroups", func(ctx context.Context) ([]*nntp.Group, error) {
+			return s.beNewGroups.NewGroups(ctx, s.clientSession, since)
+		})
+		if err != nil {
+			return err
+		}
+	}
 	c.PrintfLine("231 list of newsgroups follows")
-	c.PrintfLine(".")
+	if len(groups) == 0 {
+		// An unused DotWriter would send an empty line.
+		return c.PrintfLine(".")
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, g := range groups {
+		fmt.Fprintln(dw, g)
+	}
+	return nil
+}
+
+/*
+Indicating capability: NEWNEWS
+
+Syntax
+
+	NEWNEWS wildmat date time [GMT]
+
+Responses
+
+	230    List of new articles follows (multi-line)
+
+Parameters
+
+	wildmat    Newsgroups of interest
+	date       Date in yymmdd or yyyymmdd format
+	time       Time in hhmmss format
+
+The list comes from BackendNewNews, and NEWNEWS is only advertised when
+the backend provides it. Otherwise it's answered with 502, as the
+arrival time of articles is unknown.
+*/
+func handleNewNews(args []string, s *session, c *textproto.Conn) error {
+	if s.beNewNews == nil {
+		return ErrNewNewsUnavailable
+	}
+	if len(args) < 3 {
+		return ErrSyntax
+	}
+	wildmat, err := nntp.NewWildmat(args[0])
+	if err != nil {
+		return ErrSyntax
+	}
+	since, err := parseDateTime(args[1:], s.server.now())
+	if err != nil {
+		return err
+	}
+	ids, err := callBackend(s, "NewNews", func(ctx context.Context) ([]string, error) {
+		return s.beNewNews.NewNews(ctx, s.clientSession, wildmat, since)
+	})
+	if err != nil {
+		return err
+	}
+	c.PrintfLine("230 list of new articles by message-id follows")
+	if len(ids) == 0 {
+		// An unused DotWriter would send an empty line.
+		return c.PrintfLine(".")
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, id := range ids {
+		fmt.Fprintln(dw, id)
+	}
 	return nil
 }
 
@@ -824,19 +1405,36 @@ Parameters
 	number    Estimated number of articles in the group
 	low       Reported low water mark
 	high      Reported high water mark
+
+The numbers come from BackendGroupEstimate when the backend provides it.
+Reselecting the current group within Server.GroupCacheTTL reuses them.
+
+The current article pointer is set to the first article, or made
+invalid for an empty group.
 */
 func handleGroup(args []string, s *session, c *textproto.Conn) error {
 	if len(args) < 1 {
 		return ErrNoSuchGroup
 	}
 
-	group, err := s.backend.GetGroup(s.clientSession, args[0])
-	if err != nil {
-		return err
+	group := s.group
+	_, expired := s.server.expiredBelow(args[0])
+	if group == nil || group.Name != args[0] ||
+		time.Since(s.groupSelected) >= s.server.GroupCacheTTL ||
+		!expired.Before(s.groupSelected) {
+		var err error
+		group, err = s.estimateGroup(args[0])
+		if err != nil {
+			return err
+		}
+		s.groupSelected = time.Now()
 	}
 
 	s.group = group
 	s.number = -1
+	if group.Count > 0 && group.Low <= group.High {
+		s.number = group.Low
+	}
 
 	c.PrintfLine("211 %d %d %d %s",
 		group.Count, group.Low, group.High, group.Name)
@@ -862,21 +1460,7 @@ func handleGroup(args []string, s *session, c *textproto.Conn) error {
 Moves the current article pointer to the previous article.
 */
 func handleLast(args []string, s *session, c *textproto.Conn) error {
-	if s.group == nil {
-		return ErrNoGroupSelected
-	}
-	if s.number < 0 {
-		s.number = s.group.High + 1
-	}
-	for s.group.Low <= s.number {
-		s.number--
-		a, _ := s.backend.GetArticle(s.clientSession, s.group, fmt.Sprint(s.number))
-		if a != nil {
-			c.PrintfLine("223 %d %s", s.number, a.MessageID())
-			return nil
-		}
-	}
-	return ErrNoPreviousArticle
+	return s.moveArticle(c, false)
 }
 
 /*
@@ -895,24 +1479,112 @@ func handleLast(args []string, s *session, c *textproto.Conn) error {
 	  n             Article number
 	  message-id    Article message-id
 
-Moves the current article pointer to the next article.
+Moves the current article pointer to the next article, found with
+BackendArticleNumbers when the backend provides it (asked about a
+widening window of numbers), or else by trying each number in turn.
+LAST works the same way.
 */
 func handleNext(args []string, s *session, c *textproto.Conn) error {
+	return s.moveArticle(c, true)
+}
+
+// moveArticle moves the current article pointer to the next (or
+// previous) existing article for NEXT (or LAST). The pointer doesn't move
+// if there is none.
+func (s *session) moveArticle(c *textproto.Conn, next bool) error {
 	if s.group == nil {
 		return ErrNoGroupSelected
 	}
-	if s.number < 0 {
-		s.number = s.group.Low - 1
+	if s.number < 0 || s.number > s.group.High || s.isExpired(s.number) {
+		return ErrNoCurrentArticle
+	}
+	none := ErrNoPreviousArticle
+	from, to := s.group.Low, s.number-1
+	if next {
+		none = ErrNoNextArticle
+		from, to = s.number+1, s.group.High
+	}
+	if low, _ := s.server.expiredBelow(s.group.Name); from < low {
+		from = low
 	}
-	for s.number <= s.group.High {
-		s.number++
-		a, _ := s.backend.GetArticle(s.clientSession, s.group, fmt.Sprint(s.number))
+	if from > to {
+		return none
+	}
+	if s.beNumbers != nil {
+		n, ok, err := s.adjacentNumber(from, to, next)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return none
+		}
+		a, err := s.lookupArticle(s.group, fmt.Sprint(n))
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			return none
+		}
+		s.number = n
+		return c.PrintfLine("223 %d %s", n, a.MessageID())
+	}
+	// Without BackendArticleNumbers, probe the numbers in turn.
+	n, step := to, int64(-1)
+	if next {
+		n, step = from, 1
+	}
+	for ; from <= n && n <= to; n += step {
+		a, err := s.lookupArticle(s.group, fmt.Sprint(n))
+		if err == ErrBackendTimeout {
+			return err
+		}
 		if a != nil {
-			c.PrintfLine("223 %d %s", s.number, a.MessageID())
-			return nil
+			s.number = n
+			return c.PrintfLine("223 %d %s", n, a.MessageID())
 		}
 	}
-	return ErrNoNextArticle
+	return none
+}
+
+// moveWindow is the number of articles NEXT and LAST first ask
+// BackendArticleNumbers about.
+const moveWindow = 16
+
+// adjacentNumber returns the first (or, unless next, the last) existing
+// article number from "from" to "to". BackendArticleNumbers is asked
+// about a window next to the current article, which doubles as long as
+// it's empty, rather than about the whole range at once.
+func (s *session) adjacentNumber(from, to int64, next bool) (int64, bool, error) {
+	width := int64(moveWindow)
+	for from <= to {
+		lo, hi := from, to
+		if to-from >= width {
+			if next {
+				hi = from + width - 1
+			} else {
+				lo = to - width + 1
+			}
+		}
+		nums, err := s.lookupArticleNumbers(s.group, lo, hi)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(nums) > 0 {
+			if next {
+				return nums[0], true, nil
+			}
+			return nums[len(nums)-1], true, nil
+		}
+		if next {
+			from = hi + 1
+		} else {
+			to = lo - 1
+		}
+		if width <= math.MaxInt64/2 {
+			width *= 2
+		}
+	}
+	return 0, false, nil
 }
 
 /*
@@ -942,39 +1614,67 @@ func handleNext(args []string, s *session, c *textproto.Conn) error {
 	  n             Returned article number
 	  message-id    Article message-id
 
-If a article number is passed, the server should set the "current article pointer" to it.
+As with ARTICLE, HEAD and BODY, the article number form sets the
+current article pointer.
 */
 func handleStat(args []string, s *session, c *textproto.Conn) error {
-	article, err := s.getArticle(args)
+	n, article, err := s.getArticle(args)
 	if err != nil {
 		return err
 	}
-	if len(args) > 0 {
-		n, ok := articleIDOrNumber(args[0])
-		if ok {
-			s.number = n
-		}
-	}
-	c.PrintfLine("223 1 %s", article.MessageID())
-	return nil
+	return c.PrintfLine("223 %d %s", n, article.MessageID())
 }
 
-// internal
-func (s *session) getArticle(args []string) (*nntp.Article, error) {
+// getArticle resolves the article of ARTICLE, HEAD, BODY and STAT, and
+// returns it along with its number, which is 0 for the message-id form.
+// The current article pointer is set by the article number form.
+func (s *session) getArticle(args []string) (int64, *nntp.Article, error) {
 	if len(args) == 0 {
 		if s.group == nil {
-			return nil, ErrNoGroupSelected
+			return 0, nil, ErrNoGroupSelected
+		}
+		if s.number < 0 || s.number > s.group.High || s.isExpired(s.number) {
+			return 0, nil, ErrNoCurrentArticle
+		}
+		a, err := s.lookupArticle(s.group, fmt.Sprint(s.number))
+		if err == ErrInvalidArticleNumber || (err == nil && a == nil) {
+			err = ErrNoCurrentArticle
 		}
-		if s.number < 0 || s.number > s.group.High {
-			return nil, ErrNoCurrentArticle
+		return s.number, a, err
+	}
+	if _, nogroup := analiyzeArticleID(args[0]); nogroup {
+		a, err := s.lookupArticleNoGroup(args[0])
+		if err == ErrInvalidArticleNumber || (err == nil && a == nil) {
+			err = ErrInvalidMessageID
 		}
-		return s.backend.GetArticle(s.clientSession, s.group, fmt.Sprint(s.number))
+		return 0, a, err
 	}
 	if s.group == nil {
-		return s.backend.GetArticleWithNoGroup(s.clientSession, args[0])
-		// return nil, ErrNoGroupSelected
+		return 0, nil, ErrNoGroupSelected
+	}
+	n, ok := articleIDOrNumber(args[0])
+	if !ok {
+		return 0, nil, ErrSyntax
+	}
+	if s.isExpired(n) {
+		return 0, nil, ErrInvalidArticleNumber
+	}
+	a, err := s.lookupArticle(s.group, args[0])
+	if err == ErrInvalidMessageID || (err == nil && a == nil) {
+		err = ErrInvalidArticleNumber
+	}
+	if err != nil {
+		return 0, nil, err
 	}
-	return s.backend.GetArticle(s.clientSession, s.group, args[0])
+	s.number = n
+	return n, a, nil
+}
+
+// isExpired reports whether an article of the current group was notified
+// as expired.
+func (s *session) isExpired(n int64) bool {
+	low, _ := s.server.expiredBelow(s.group.Name)
+	return n < low
 }
 
 /*
@@ -1002,11 +1702,11 @@ Third form (current article number used)
 	420                   Current article number is invalid
 */
 func handleHead(args []string, s *session, c *textproto.Conn) error {
-	article, err := s.getArticle(args)
+	n, article, err := s.getArticle(args)
 	if err != nil {
 		return err
 	}
-	c.PrintfLine("221 1 %s", article.MessageID())
+	c.PrintfLine("221 %d %s", n, article.MessageID())
 	dw := c.DotWriter()
 	defer dw.Close()
 	for k, v := range article.Header {
@@ -1051,11 +1751,11 @@ Parameters
 	message-id    Article message-id
 */
 func handleBody(args []string, s *session, c *textproto.Conn) error {
-	article, err := s.getArticle(args)
+	n, article, err := s.getArticle(args)
 	if err != nil {
 		return err
 	}
-	c.PrintfLine("222 1 %s", article.MessageID())
+	c.PrintfLine("222 %d %s", n, article.MessageID())
 	dw := c.DotWriter()
 	defer dw.Close()
 	_, err = io.Copy(dw, article.Body)
@@ -1095,14 +1795,11 @@ Parameters
 	message-id    Article message-id
 */
 func handleArticle(args []string, s *session, c *textproto.Conn) error {
-	article, err := s.getArticle(args)
+	n, article, err := s.getArticle(args)
 	if err != nil {
 		return err
 	}
-	if article == nil {
-		return fmt.Errorf("empty article")
-	}
-	c.PrintfLine("220 1 %s", article.MessageID())
+	c.PrintfLine("220 %d %s", n, article.MessageID())
 	dw := c.DotWriter()
 	defer dw.Close()
 
@@ -1119,6 +1816,52 @@ func handleArticle(args []string, s *session, c *textproto.Conn) error {
 	return err
 }
 
+// checkNewsgroups checks that every group a posted article is sent to
+// exists and may be posted to, since an article is either accepted for
+// all its groups or rejected (RFC 5537, section 3.5). IHAVE doesn't do
+// this, as relayed articles are commonly crossposted to groups a server
+// doesn't carry. Articles to moderated groups are passed to the backend
+// even without an Approved header, since they are then forwarded to the
+// moderator (RFC 5537, section 3.5.1).
+func (s *session) checkNewsgroups(header textproto.MIMEHeader) error {
+	for _, name := range strings.Split(header.Get("Newsgroups"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		reject := func(reason string) error {
+			return &NNTPError{441, fmt.Sprintf("Posting to %s failed: %s", name, reason)}
+		}
+		g, err := s.lookupGroup(name)
+		if err == ErrNoSuchGroup {
+			return reject("no such newsgroup")
+		}
+		if err != nil {
+			return err
+		}
+		if g.Posting == nntp.PostingNotPermitted || g.Posting == nntp.PostingNoLocal {
+			return reject("posting not permitted")
+		}
+		if s.bePostGroup != nil && !s.bePostGroup.AllowPostGroup(s.ctx, s.clientSession, g) {
+			return reject("posting not permitted")
+		}
+	}
+	return nil
+}
+
+// validateHeaders checks that an article has the headers the server
+// requires, replying with code if it doesn't.
+func (s *session) validateHeaders(header textproto.MIMEHeader, code int) error {
+	required := s.server.RequiredHeaders
+	if required == nil {
+		required = nntp.RequiredPostHeaders
+	}
+	if err := nntp.ValidatePostHeaders(header, required); err != nil {
+		return &NNTPError{code, "Article rejected: " + err.Error()}
+	}
+	return nil
+}
+
 /*
 Indicating capability: POST
 
@@ -1139,9 +1882,18 @@ Subsequent responses
 
 	240    Article received OK
 	441    Posting failed
+
+Everything up to the terminating line is taken as the article, even a
+line reading QUIT. If the client hangs up before the article is
+complete, the session ends without a response, and whatever the backend
+returns for the truncated article is ignored. Backends must not store an
+article whose body fails to read.
 */
 func handlePost(args []string, s *session, c *textproto.Conn) error {
-	if !s.backend.AllowPost(s.clientSession) {
+	if s.server.RequireTLSForPost && !s.tls {
+		return ErrTLSRequired
+	}
+	if !s.backend.AllowPost(s.ctx, s.clientSession) {
 		return ErrPostingNotPermitted
 	}
 
@@ -1150,16 +1902,26 @@ func handlePost(args []string, s *session, c *textproto.Conn) error {
 	var article nntp.Article
 	article.Header, err = c.ReadMIMEHeader()
 	if err != nil {
+		if hungUp(err) {
+			return io.EOF
+		}
 		return ErrPostingFailed
 	}
+	body := newArticleBody(c)
+	if err := s.validateHeaders(article.Header, 441); err != nil {
+		return body.finish(err)
+	}
+	if err := s.checkNewsgroups(article.Header); err != nil {
+		return body.finish(err)
+	}
 	{
 		msgID := article.Header.Get("Message-ID")
 		if msgID == "" {
 			article.Header.Set("Message-ID", s.idGenerator.GenID())
 		}
 	}
-	article.Body = c.DotReader()
-	err = s.backend.Post(s.clientSession, &article)
+	article.Body = body
+	err = body.finish(s.backend.Post(s.ctx, s.clientSession, &article))
 	if err != nil {
 		return err
 	}
@@ -1193,15 +1955,22 @@ Subsequent responses
 Parameters
 
 	message-id    Article message-id
+
+Articles lacking any of the Server.RequiredHeaders are rejected with 437
+(441 for POST).
 */
 func handleIHave(args []string, s *session, c *textproto.Conn) error {
 	if len(args) < 1 {
 		return ErrSyntax
 	}
-	if !s.backend.AllowPost(s.clientSession) {
+	if s.server.RequireTLSForPost && !s.tls {
+		return ErrTLSRequired
+	}
+	if !s.backend.AllowPost(s.ctx, s.clientSession) {
 		return ErrNotWanted
 	}
 	var article *nntp.Article
+	var body *articleBody
 	var err error
 
 	if s.beIhave != nil {
@@ -1209,7 +1978,7 @@ func handleIHave(args []string, s *session, c *textproto.Conn) error {
 	}
 
 	// See if we have it.
-	article, err = s.backend.GetArticleWithNoGroup(s.clientSession, args[0])
+	article, err = s.lookupArticleNoGroup(args[0])
 	if article != nil {
 		return ErrNotWanted
 	}
@@ -1218,10 +1987,17 @@ func handleIHave(args []string, s *session, c *textproto.Conn) error {
 	article = &nntp.Article{}
 	article.Header, err = c.ReadMIMEHeader()
 	if err != nil {
+		if hungUp(err) {
+			return io.EOF
+		}
 		return ErrIHaveFailed
 	}
-	article.Body = c.DotReader()
-	err = s.backend.Post(s.clientSession, article)
+	body = newArticleBody(c)
+	if err := s.validateHeaders(article.Header, 437); err != nil {
+		return body.finish(err)
+	}
+	article.Body = body
+	err = body.finish(s.backend.Post(s.ctx, s.clientSession, article))
 	if err != nil {
 		if err == ErrPostingFailed {
 			err = ErrIHaveFailed
@@ -1233,7 +2009,7 @@ func handleIHave(args []string, s *session, c *textproto.Conn) error {
 way_use_beIhave:
 
 	// See if we have it.
-	err = s.beIhave.IHaveWantArticle(s.clientSession, args[0])
+	err = s.beIhave.IHaveWantArticle(s.ctx, s.clientSession, args[0])
 	if err != nil {
 		return err
 	}
@@ -1242,10 +2018,17 @@ way_use_beIhave:
 	article = &nntp.Article{}
 	article.Header, err = c.ReadMIMEHeader()
 	if err != nil {
+		if hungUp(err) {
+			return io.EOF
+		}
 		return ErrIHaveFailed
 	}
-	article.Body = c.DotReader()
-	err = s.beIhave.IHave(s.clientSession, args[0], article)
+	body = newArticleBody(c)
+	if err := s.validateHeaders(article.Header, 437); err != nil {
+		return body.finish(err)
+	}
+	article.Body = body
+	err = body.finish(s.beIhave.IHave(s.ctx, s.clientSession, args[0], article))
 	if err != nil {
 		return err
 	}
@@ -1271,7 +2054,10 @@ func handleCheck(args []string, s *session, c *textproto.Conn) error {
 	if len(args) < 1 {
 		return ErrSyntax
 	}
-	if !s.backend.AllowPost(s.clientSession) {
+	if s.server.RequireTLSForPost && !s.tls {
+		return ErrTLSRequired
+	}
+	if !s.backend.AllowPost(s.ctx, s.clientSession) {
 		return c.PrintfLine("438 %s", args[0])
 	}
 	var article *nntp.Article
@@ -1282,7 +2068,7 @@ func handleCheck(args []string, s *session, c *textproto.Conn) error {
 	}
 
 	// See if we have it.
-	article, err = s.backend.GetArticleWithNoGroup(s.clientSession, args[0])
+	article, err = s.lookupArticleNoGroup(args[0])
 	if article != nil {
 		return c.PrintfLine("438 %s", args[0])
 	}
@@ -1292,7 +2078,7 @@ func handleCheck(args []string, s *session, c *textproto.Conn) error {
 way_use_beIhave:
 
 	// See if we have it.
-	err = s.beIhave.IHaveWantArticle(s.clientSession, args[0])
+	err = s.beIhave.IHaveWantArticle(s.ctx, s.clientSession, args[0])
 	if err != nil {
 		return c.PrintfLine("438 %s", args[0])
 	}
@@ -1319,7 +2105,11 @@ func handleTakethis(args []string, s *session, c *textproto.Conn) error {
 		io.Copy(io.Discard, c.DotReader())
 		return c.PrintfLine("501 unknown syntax")
 	}
-	if !s.backend.AllowPost(s.clientSession) {
+	if s.server.RequireTLSForPost && !s.tls {
+		io.Copy(io.Discard, c.DotReader())
+		return ErrTLSRequired
+	}
+	if !s.backend.AllowPost(s.ctx, s.clientSession) {
 		io.Copy(io.Discard, c.DotReader())
 		return c.PrintfLine("439 %s", args[0])
 	}
@@ -1331,7 +2121,7 @@ func handleTakethis(args []string, s *session, c *textproto.Conn) error {
 	}
 
 	// See if we have it.
-	article, err = s.backend.GetArticleWithNoGroup(s.clientSession, args[0])
+	article, err = s.lookupArticleNoGroup(args[0])
 	if article != nil {
 		io.Copy(io.Discard, c.DotReader())
 		return c.PrintfLine("439 %s", args[0])
@@ -1345,7 +2135,7 @@ func handleTakethis(args []string, s *session, c *textproto.Conn) error {
 		return c.PrintfLine("439 %s", args[0])
 	}
 	article.Body = c.DotReader()
-	err = s.backend.Post(s.clientSession, article)
+	err = s.backend.Post(s.ctx, s.clientSession, article)
 	if err != nil {
 		io.Copy(io.Discard, article.Body)
 		return c.PrintfLine("439 %s", args[0])
@@ -1355,7 +2145,7 @@ func handleTakethis(args []string, s *session, c *textproto.Conn) error {
 way_use_beIhave:
 
 	// See if we have it.
-	err = s.beIhave.IHaveWantArticle(s.clientSession, args[0])
+	err = s.beIhave.IHaveWantArticle(s.ctx, s.clientSession, args[0])
 	if err != nil {
 		io.Copy(io.Discard, c.DotReader())
 		return c.PrintfLine("439 %s", args[0])
@@ -1368,7 +2158,7 @@ way_use_beIhave:
 		return c.PrintfLine("439 %s", args[0])
 	}
 	article.Body = c.DotReader()
-	err = s.beIhave.IHave(s.clientSession, args[0], article)
+	err = s.beIhave.IHave(s.ctx, s.clientSession, args[0], article)
 	if err != nil {
 		io.Copy(io.Discard, article.Body)
 		return c.PrintfLine("439 %s", args[0])
@@ -1384,10 +2174,28 @@ Syntax
 Responses
 
 	100    Help text follows (multi-line)
+
+The text lists the registered commands, followed by Server.HelpText.
 */
 func handleHelp(args []string, s *session, c *textproto.Conn) error {
+	var names []string
+	for name := range s.server.Handlers {
+		if name != "" {
+			names = append(names, strings.ToUpper(name))
+		}
+	}
+	sort.Strings(names)
+
 	c.PrintfLine("100 Help text follows (multi-line)")
-	c.PrintfLine(".")
+	dw := c.DotWriter()
+	defer dw.Close()
+	fmt.Fprintln(dw, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(dw, "  %s\n", name)
+	}
+	if s.server.HelpText != "" {
+		fmt.Fprintln(dw, strings.TrimRight(s.server.HelpText, "\r\n"))
+	}
 	return nil
 }
 
@@ -1401,12 +2209,58 @@ Syntax
 Responses
 
 	111 yyyymmddhhmmss    Server date and time
+
+The time, in UTC, is taken from Server.Now if set.
 */
 func handleDate(args []string, s *session, c *textproto.Conn) error {
-	t := time.Now().UTC() // don't leak local time
-	Y, M, D := t.Date()
-	h, m, z := t.Clock()
-	c.PrintfLine("111 %04d%02d%02d%02d%02d%02d", Y, int(M), D, h, m, z)
+	t := s.server.now().UTC() // don't leak local time
+	return c.PrintfLine("111 %s", t.Format("20060102150405"))
+}
+
+/*
+Documented outside RFC 3977 --> RFC 4642
+
+Indicating capability: STARTTLS
+
+Syntax
+
+	STARTTLS
+
+Responses
+
+	382    Continue with TLS negotiation
+	502    Command unavailable
+	580    Can not initiate TLS negotiation
+
+The connection is dropped if the negotiation fails. Otherwise, the
+client starts over, with no group selected, as required by RFC 4642,
+section 2.2.2. As authentication disables STARTTLS, there is no
+authentication state to carry over.
+
+STARTTLS followed by pipelined commands is refused with 580, since
+these would be read before the negotiation, unprotected.
+*/
+func handleStartTLS(args []string, s *session, c *textproto.Conn) error {
+	if s.server.TLSConfig == nil || s.tls || s.identity != "" {
+		return ErrTLSUnavailable
+	}
+	conn, ok := s.conn.(net.Conn)
+	if !ok || c.R.Buffered() > 0 {
+		return ErrTLSNotPossible
+	}
+	if err := c.PrintfLine("382 Continue with TLS negotiation"); err != nil {
+		return err
+	}
+	tlsConn := tls.Server(conn, s.server.TLSConfig)
+	if err := tlsConn.HandshakeContext(s.ctx); err != nil {
+		s.log.Debug("TLS negotiation failed, dropping conn", "error", err)
+		return err
+	}
+	s.conn = tlsConn
+	s.text = textproto.NewConn(tlsConn)
+	s.tls = true
+	s.group = nil
+	s.number = -1
 	return nil
 }
 
@@ -1417,8 +2271,15 @@ func handleCap(args []string, s *session, c *textproto.Conn) error {
 
 	fmt.Fprintf(dw, "VERSION 2\n")
 	fmt.Fprintf(dw, "READER\n")
+	if s.beNewNews != nil {
+		fmt.Fprintf(dw, "NEWNEWS\n")
+	}
 	fmt.Fprintf(dw, "STREAMING\n")
-	if s.backend.AllowPost(s.clientSession) {
+	if s.server.TLSConfig != nil && !s.tls && s.identity == "" {
+		fmt.Fprintf(dw, "STARTTLS\n")
+	}
+	if s.backend.AllowPost(s.ctx, s.clientSession) &&
+		(s.tls || !s.server.RequireTLSForPost) {
 		fmt.Fprintf(dw, "POST\n")
 		fmt.Fprintf(dw, "IHAVE\n")
 	}
@@ -1427,6 +2288,12 @@ func handleCap(args []string, s *session, c *textproto.Conn) error {
 	fmt.Fprintf(dw, "HDR\n")
 	fmt.Fprintf(dw, "XHDR\n")
 	fmt.Fprintf(dw, "LIST ACTIVE NEWSGROUPS HEADER OVERVIEW.FMT\n")
+	if s.server.SASL != nil && s.identity == "" &&
+		(s.tls || !s.server.RequireTLSForAuth) {
+		fmt.Fprintf(dw, "AUTHINFO SASL\n")
+		fmt.Fprintf(dw, "SASL %s\n",
+			strings.Join(s.server.SASL.Mechanisms(s.clientSession), " "))
+	}
 	return nil
 }
 
@@ -1470,7 +2337,7 @@ func handleMode(args []string, s *session, c *textproto.Conn) error {
 	case "reader":
 		fallthrough
 	default:
-		if s.backend.AllowPost(s.clientSession) {
+		if s.backend.AllowPost(s.ctx, s.clientSession) {
 			c.PrintfLine("200 Posting allowed")
 		} else {
 			c.PrintfLine("201 Posting prohibited")
@@ -1510,11 +2377,22 @@ Documented outside RFC 3977 --> RFC 4643
 
 	   [C] AUTHINFO PASS flintstone
 	   [S] 482 Authentication commands issued out of sequence
+
+AUTHINFO SASL is handled by handleAuthInfoSASL.
 */
 func handleAuthInfo(args []string, s *session, c *textproto.Conn) error {
 	if len(args) < 2 {
 		return ErrSyntax
 	}
+	if s.server.RequireTLSForAuth && !s.tls {
+		return ErrTLSRequired
+	}
+	if strings.ToLower(args[0]) == "sasl" {
+		return handleAuthInfoSASL(args, s, c)
+	}
+	if s.identity != "" {
+		return ErrAuthAlreadyDone
+	}
 	if strings.ToLower(args[0]) != "user" {
 		if strings.ToLower(args[0]) == "pass" {
 			return c.PrintfLine("482 Authentication commands issued out of sequence")
@@ -1532,8 +2410,9 @@ func handleAuthInfo(args []string, s *session, c *textproto.Conn) error {
 	if strings.ToLower(parts[0]) != "authinfo" || strings.ToLower(parts[1]) != "pass" {
 		return ErrSyntax
 	}
-	b, err := s.backend.Authenticate(s.clientSession, args[1], parts[2])
+	b, err := s.backend.Authenticate(s.ctx, s.clientSession, args[1], parts[2])
 	if err == nil {
+		s.setIdentity(args[1])
 		c.PrintfLine("281 authenticated")
 		// c.PrintfLine("250 authenticated")
 		if b != nil {
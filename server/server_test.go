@@ -28,8 +28,22 @@
 package nntpserver
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
 	"math"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/kothawoc/go-nntp"
 )
 
 type rangeExpectation struct {
@@ -42,6 +56,7 @@ var rangeExpectations = []rangeExpectation{
 	{"", 0, math.MaxInt64},
 	{"73-", 73, math.MaxInt64},
 	{"73-1845", 73, 1845},
+	{"73", 73, 73},
 }
 
 func TestRangeEmpty(t *testing.T) {
@@ -57,3 +72,1100 @@ func TestRangeEmpty(t *testing.T) {
 		}
 	}
 }
+
+// testBackend is a minimal in-memory Backend; tests embed it and
+// override what they exercise.
+type testBackend struct {
+	groups map[string]*nntp.Group
+	users  map[string]string
+}
+
+func newTestBackend() *testBackend {
+	return &testBackend{
+		groups: map[string]*nntp.Group{
+			"misc.test": {Name: "misc.test", Count: 3, Low: 1, High: 4,
+				Posting: nntp.PostingPermitted},
+		},
+		users: map[string]string{"fred": "flintstone"},
+	}
+}
+
+func (tb *testBackend) ListGroups(ctx context.Context, session map[string]string) (<-chan *nntp.Group, error) {
+	ch := make(chan *nntp.Group, len(tb.groups))
+	for _, g := range tb.groups {
+		ch <- g
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (tb *testBackend) GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error) {
+	g, ok := tb.groups[name]
+	if !ok {
+		return nil, ErrNoSuchGroup
+	}
+	return g, nil
+}
+
+func (tb *testBackend) GetArticleWithNoGroup(ctx context.Context, session map[string]string, id string) (*nntp.Article, error) {
+	return nil, ErrInvalidMessageID
+}
+
+// GetArticle finds every article between a group's water marks.
+func (tb *testBackend) GetArticle(ctx context.Context, session map[string]string, group *nntp.Group, id string) (*nntp.Article, error) {
+	n, ok := articleIDOrNumber(id)
+	if !ok || n < group.Low || n > group.High {
+		return nil, ErrInvalidArticleNumber
+	}
+	return &nntp.Article{
+		Header: textproto.MIMEHeader{
+			"Message-Id": {fmt.Sprintf("<%d@%s>", n, group.Name)},
+		},
+		Body: strings.NewReader("body\n"),
+	}, nil
+}
+
+func (tb *testBackend) GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	ch := make(chan NumberedArticle)
+	close(ch)
+	return ch, nil
+}
+
+func (tb *testBackend) Authorized(ctx context.Context, session map[string]string) bool {
+	return true
+}
+
+func (tb *testBackend) Authenticate(ctx context.Context, session map[string]string, user, pass string) (Backend, error) {
+	if p, ok := tb.users[user]; ok && p == pass {
+		return nil, nil
+	}
+	return nil, ErrAuthRejected
+}
+
+func (tb *testBackend) AllowPost(ctx context.Context, session map[string]string) bool {
+	return false
+}
+
+func (tb *testBackend) Post(ctx context.Context, session map[string]string, article *nntp.Article) error {
+	return ErrPostingNotPermitted
+}
+
+type testIDGen struct{}
+
+func (testIDGen) GenID() string {
+	return "<generated@example.com>"
+}
+
+// newTestConn runs a session of s and returns the client end of it,
+// along with the session's ClientSession.
+func newTestConn(t *testing.T, s *Server) (*textproto.Conn, ClientSession) {
+	t.Helper()
+	cconn, sconn := net.Pipe()
+	cs := ClientSession{}
+	go s.Process(sconn, cs)
+	c := textproto.NewConn(cconn)
+	t.Cleanup(func() { c.Close() })
+	if _, _, err := c.ReadCodeLine(200); err != nil {
+		t.Fatalf("Error reading banner: %v", err)
+	}
+	return c, cs
+}
+
+// cmd sends a command and checks the response code.
+func cmd(t *testing.T, c *textproto.Conn, expectCode int, format string, args ...interface{}) string {
+	t.Helper()
+	if err := c.PrintfLine(format, args...); err != nil {
+		t.Fatalf("Error sending %q: %v", format, err)
+	}
+	_, msg, err := c.ReadCodeLine(expectCode)
+	if err != nil {
+		t.Fatalf("Unexpected response to %q: %v", fmt.Sprintf(format, args...), err)
+	}
+	return msg
+}
+
+// capabilities issues CAPABILITIES and returns the lines.
+func capabilities(t *testing.T, c *textproto.Conn) []string {
+	t.Helper()
+	cmd(t, c, 101, "CAPABILITIES")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatalf("Error reading capabilities: %v", err)
+	}
+	return lines
+}
+
+func hasLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAuthInfoUserPass(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, cs := newTestConn(t, s)
+	if caps := capabilities(t, c); hasLine(caps, "AUTHINFO SASL") {
+		t.Fatalf("SASL advertised without a provider: %q", caps)
+	}
+	cmd(t, c, 381, "AUTHINFO USER fred")
+	cmd(t, c, 281, "AUTHINFO PASS flintstone")
+	if cs[IdentityKey] != "fred" {
+		t.Fatalf("Got identity %q, wanted fred", cs[IdentityKey])
+	}
+	cmd(t, c, 502, "AUTHINFO USER fred")
+}
+
+func TestAuthInfoSASLPlain(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.SASL = &BuiltinSASL{}
+
+	c, cs := newTestConn(t, s)
+	caps := capabilities(t, c)
+	if !hasLine(caps, "AUTHINFO SASL") || !hasLine(caps, "SASL PLAIN") {
+		t.Fatalf("SASL not advertised: %q", caps)
+	}
+	cmd(t, c, 481, "AUTHINFO SASL PLAIN %s",
+		base64.StdEncoding.EncodeToString([]byte("\x00fred\x00wrong")))
+	cmd(t, c, 503, "AUTHINFO SASL CRAM-MD5")
+	if cs[IdentityKey] != "" {
+		t.Fatalf("Identity %q set by failed authentication", cs[IdentityKey])
+	}
+	cmd(t, c, 281, "AUTHINFO SASL PLAIN %s",
+		base64.StdEncoding.EncodeToString([]byte("\x00fred\x00flintstone")))
+	if cs[IdentityKey] != "fred" {
+		t.Fatalf("Got identity %q, wanted fred", cs[IdentityKey])
+	}
+	cmd(t, c, 502, "AUTHINFO SASL PLAIN =")
+	caps = capabilities(t, c)
+	if hasLine(caps, "AUTHINFO SASL") || hasLine(caps, "SASL PLAIN") {
+		t.Fatalf("SASL advertised after authentication: %q", caps)
+	}
+
+	c, cs = newTestConn(t, s)
+	cmd(t, c, 383, "AUTHINFO SASL PLAIN")
+	cmd(t, c, 281, "%s", base64.StdEncoding.EncodeToString([]byte("fred\x00fred\x00flintstone")))
+	if cs[IdentityKey] != "fred" {
+		t.Fatalf("Got identity %q, wanted fred", cs[IdentityKey])
+	}
+
+	c, _ = newTestConn(t, s)
+	cmd(t, c, 383, "AUTHINFO SASL PLAIN")
+	cmd(t, c, 481, "*")
+}
+
+func TestAuthInfoSASLExternal(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.SASL = &BuiltinSASL{
+		External: func(session map[string]string) string {
+			return "wilma"
+		},
+	}
+	c, cs := newTestConn(t, s)
+	if caps := capabilities(t, c); !hasLine(caps, "SASL PLAIN EXTERNAL") {
+		t.Fatalf("EXTERNAL not advertised: %q", caps)
+	}
+	cmd(t, c, 481, "AUTHINFO SASL EXTERNAL %s", base64.StdEncoding.EncodeToString([]byte("fred")))
+	cmd(t, c, 281, "AUTHINFO SASL EXTERNAL =")
+	if cs[IdentityKey] != "wilma" {
+		t.Fatalf("Got identity %q, wanted wilma", cs[IdentityKey])
+	}
+}
+
+func TestAuthInfoSASLExternalWithoutIdentity(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.SASL = &BuiltinSASL{
+		External: func(session map[string]string) string {
+			return ""
+		},
+	}
+	c, _ := newTestConn(t, s)
+	if caps := capabilities(t, c); !hasLine(caps, "SASL PLAIN") {
+		t.Fatalf("EXTERNAL advertised without an identity: %q", caps)
+	}
+	cmd(t, c, 503, "AUTHINFO SASL EXTERNAL =")
+}
+
+// slowBackend delays GetGroup, and produces GetArticles streams slowly
+// while honouring the context.
+type slowBackend struct {
+	*testBackend
+	delay time.Duration
+}
+
+func (sb *slowBackend) GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error) {
+	if name == "slow.test" {
+		time.Sleep(sb.delay)
+	}
+	return sb.testBackend.GetGroup(ctx, session, name)
+}
+
+func (sb *slowBackend) GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	ch := make(chan NumberedArticle)
+	go func() {
+		defer close(ch)
+		for n := max(from, group.Low); n <= to && n <= group.High; n++ {
+			select {
+			case <-time.After(sb.delay):
+			case <-ctx.Done():
+				return
+			}
+			a := &nntp.Article{Header: textproto.MIMEHeader{}}
+			select {
+			case ch <- NumberedArticle{n, a}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestBackendTimeout(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	tb := newTestBackend()
+	tb.groups["slow.test"] = &nntp.Group{Name: "slow.test"}
+	s := NewServer(&slowBackend{tb, 100 * time.Millisecond}, testIDGen{})
+	s.BackendTimeout = 20 * time.Millisecond
+
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 403, "GROUP slow.test")
+	if !strings.Contains(logs.String(), "Backend operation timed out") ||
+		!strings.Contains(logs.String(), "op=GetGroup") {
+		t.Fatalf("Timeout not logged: %q", logs.String())
+	}
+	cmd(t, c, 211, "GROUP misc.test")
+}
+
+func TestBackendTimeoutStream(t *testing.T) {
+	// The stream takes longer than the timeout, but the call returns
+	// immediately, so the output must not be cut short.
+	s := NewServer(&slowBackend{newTestBackend(), 15 * time.Millisecond}, testIDGen{})
+	s.BackendTimeout = 20 * time.Millisecond
+
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "LISTGROUP misc.test")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatalf("Error reading article numbers: %v", err)
+	}
+	if strings.Join(lines, " ") != "1 2 3 4" {
+		t.Fatalf("Got article numbers %q", lines)
+	}
+}
+
+// estimateBackend answers GROUP from estimates differing from GetGroup,
+// and records the group of the last article retrieved.
+type estimateBackend struct {
+	*testBackend
+	group *nntp.Group
+}
+
+func (eb *estimateBackend) GetArticle(ctx context.Context, session map[string]string, group *nntp.Group, id string) (*nntp.Article, error) {
+	eb.group = group
+	return eb.testBackend.GetArticle(ctx, session, group, id)
+}
+
+func (eb *estimateBackend) GroupEstimate(ctx context.Context, session map[string]string, name string) (count, low, high int64, err error) {
+	switch name {
+	case "misc.test":
+		return 5, 1, 6, nil
+	case "empty.test":
+		return 0, 10, 9, nil
+	}
+	return 0, 0, 0, ErrNoSuchGroup
+}
+
+func TestGroupEstimate(t *testing.T) {
+	eb := &estimateBackend{testBackend: newTestBackend()}
+	s := NewServer(eb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	if msg := cmd(t, c, 211, "GROUP misc.test"); msg != "5 1 6 misc.test" {
+		t.Fatalf("Got %q", msg)
+	}
+	cmd(t, c, 223, "STAT 1")
+	if eb.group.Posting != 0 {
+		t.Fatalf("Estimated group has posting status %q", eb.group.Posting)
+	}
+	// Reselecting the group keeps what GetGroup said about it.
+	cmd(t, c, 211, "GROUP empty.test")
+	cmd(t, c, 211, "LISTGROUP misc.test")
+	c.ReadDotLines()
+	cmd(t, c, 211, "GROUP misc.test")
+	cmd(t, c, 223, "STAT 1")
+	if eb.group.Count != 5 || eb.group.Posting != nntp.PostingPermitted {
+		t.Fatalf("Got group %+v after reselecting it", eb.group)
+	}
+	if msg := cmd(t, c, 211, "GROUP empty.test"); msg != "0 10 9 empty.test" {
+		t.Fatalf("Got %q", msg)
+	}
+	cmd(t, c, 411, "GROUP no.such.group")
+}
+
+// countingBackend counts GetGroup calls.
+type countingBackend struct {
+	*testBackend
+	getGroups int
+}
+
+func (cb *countingBackend) GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error) {
+	cb.getGroups++
+	return cb.testBackend.GetGroup(ctx, session, name)
+}
+
+func TestGroupReselect(t *testing.T) {
+	cb := &countingBackend{testBackend: newTestBackend()}
+	s := NewServer(cb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		s.GroupCacheTTL = ttl
+		cb.getGroups = 0
+		for i := 0; i < 2; i++ {
+			cmd(t, c, 211, "GROUP misc.test")
+			// The pointer is back on the first article.
+			if msg := cmd(t, c, 223, "NEXT"); msg != "2 <2@misc.test>" {
+				t.Fatalf("Got %q", msg)
+			}
+		}
+		if ttl == 0 && cb.getGroups != 2 {
+			t.Fatalf("Got %d lookups without cache, wanted 2", cb.getGroups)
+		}
+		if ttl != 0 && cb.getGroups != 0 {
+			t.Fatalf("Got %d lookups with cache, wanted 0", cb.getGroups)
+		}
+	}
+}
+
+func TestListgroupCachesGroup(t *testing.T) {
+	cb := &countingBackend{testBackend: newTestBackend()}
+	cb.groups["alt.test"] = &nntp.Group{Name: "alt.test", Low: 1, High: 0}
+	s := NewServer(cb, testIDGen{})
+	s.GroupCacheTTL = 200 * time.Millisecond
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 211, "GROUP alt.test")
+	// Longer ago than the TTL.
+	time.Sleep(250 * time.Millisecond)
+	cmd(t, c, 211, "LISTGROUP misc.test")
+	c.ReadDotLines()
+	// The group LISTGROUP looked up is reused.
+	cmd(t, c, 211, "GROUP misc.test")
+	if cb.getGroups != 2 {
+		t.Fatalf("Got %d group lookups, wanted 2", cb.getGroups)
+	}
+}
+
+func TestCommandsNeedGroup(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	tests := []struct {
+		cmd  string
+		code int
+	}{
+		{"ARTICLE 1", 220},
+		{"HEAD 1", 221},
+		{"BODY 1", 222},
+		{"STAT 1", 223},
+		{"OVER 1-2", 224},
+		{"HDR Subject 1-2", 225},
+	}
+	for _, test := range tests {
+		cmd(t, c, 412, test.cmd)
+	}
+	// The message-id forms don't need a group.
+	for _, id := range []string{"ARTICLE", "HEAD", "BODY", "STAT", "OVER", "HDR Subject"} {
+		cmd(t, c, 430, "%s <nosuch@example.com>", id)
+	}
+	cmd(t, c, 211, "GROUP misc.test")
+	for _, test := range tests {
+		cmd(t, c, test.code, test.cmd)
+		if test.code != 223 {
+			if _, err := c.ReadDotLines(); err != nil {
+				t.Fatalf("Error reading response to %q: %v", test.cmd, err)
+			}
+		}
+	}
+}
+
+func TestStat(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+
+	for _, test := range []struct {
+		cmd      string
+		code     int
+		expected string
+	}{
+		{"STAT", 223, "1 <1@misc.test>"},
+		{"STAT 3", 223, "3 <3@misc.test>"},
+		// The pointer was moved to 3, and stays there.
+		{"STAT 9", 423, ""},
+		{"STAT", 223, "3 <3@misc.test>"},
+		{"STAT three", 501, ""},
+	} {
+		msg := cmd(t, c, test.code, "%s", test.cmd)
+		if test.expected != "" && msg != test.expected {
+			t.Errorf("Got %q for %s, wanted %q", msg, test.cmd, test.expected)
+		}
+	}
+	if msg := cmd(t, c, 221, "HEAD"); msg != "3 <3@misc.test>" {
+		t.Errorf("Got %q for HEAD", msg)
+	}
+	c.ReadDotLines()
+}
+
+func TestNextLast(t *testing.T) {
+	nb := &numbersBackend{newTestBackend()}
+	nb.groups["empty.test"] = &nntp.Group{Name: "empty.test", Low: 5, High: 4}
+	s := NewServer(nb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 412, "NEXT")
+	cmd(t, c, 211, "GROUP empty.test")
+	cmd(t, c, 420, "NEXT")
+	cmd(t, c, 420, "LAST")
+
+	cmd(t, c, 211, "GROUP misc.test")
+	for _, test := range []struct {
+		cmd      string
+		code     int
+		expected string
+	}{
+		{"LAST", 422, ""},
+		// Article 2 is missing.
+		{"NEXT", 223, "3 <3@misc.test>"},
+		{"NEXT", 223, "4 <4@misc.test>"},
+		{"NEXT", 421, ""},
+		{"STAT", 223, "4 <4@misc.test>"},
+		{"LAST", 223, "3 <3@misc.test>"},
+		{"LAST", 223, "1 <1@misc.test>"},
+	} {
+		msg := cmd(t, c, test.code, "%s", test.cmd)
+		if test.expected != "" && msg != test.expected {
+			t.Errorf("Got %q for %s, wanted %q", msg, test.cmd, test.expected)
+		}
+	}
+
+	// Without BackendArticleNumbers, every number is tried.
+	s = NewServer(newTestBackend(), testIDGen{})
+	c, _ = newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+	if msg := cmd(t, c, 223, "NEXT"); msg != "2 <2@misc.test>" {
+		t.Errorf("Got %q for NEXT", msg)
+	}
+}
+
+// sparseBackend has a large group with few articles, and records the
+// ranges of numbers it's asked about.
+type sparseBackend struct {
+	*testBackend
+	ranges [][2]int64
+}
+
+func (sb *sparseBackend) ArticleNumbers(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) ([]int64, error) {
+	sb.ranges = append(sb.ranges, [2]int64{from, to})
+	var nums []int64
+	for _, n := range []int64{1, 500000, 1000000} {
+		if from <= n && n <= to {
+			nums = append(nums, n)
+		}
+	}
+	return nums, nil
+}
+
+func TestNextLastWindow(t *testing.T) {
+	sb := &sparseBackend{testBackend: newTestBackend()}
+	sb.groups["big.test"] = &nntp.Group{Name: "big.test", Count: 3, Low: 1, High: 1000000}
+	s := NewServer(sb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 211, "GROUP big.test")
+	if msg := cmd(t, c, 223, "NEXT"); msg != "500000 <500000@big.test>" {
+		t.Fatalf("Got %q for NEXT", msg)
+	}
+	// The window doubles from the current article.
+	if len(sb.ranges) < 2 || sb.ranges[0] != [2]int64{2, 17} || sb.ranges[1] != [2]int64{18, 49} {
+		t.Fatalf("Backend asked for %v", sb.ranges)
+	}
+	sb.ranges = nil
+	if msg := cmd(t, c, 223, "LAST"); msg != "1 <1@big.test>" {
+		t.Fatalf("Got %q for LAST", msg)
+	}
+	if sb.ranges[0] != [2]int64{499984, 499999} {
+		t.Fatalf("Backend asked for %v", sb.ranges)
+	}
+	for _, r := range sb.ranges {
+		if r[1]-r[0] >= 500000/2 {
+			t.Fatalf("Backend asked for %v at once", r)
+		}
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		args     []string
+		expected time.Time
+	}{
+		{[]string{"20240115", "123456", "GMT"}, time.Date(2024, 1, 15, 12, 34, 56, 0, time.UTC)},
+		{[]string{"240115", "000000", "gmt"}, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// Two-digit years after the current one are from the previous
+		// century.
+		{[]string{"990115", "000000", "GMT"}, time.Date(1999, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{[]string{"19990115", "000000"}, time.Date(1999, 1, 15, 0, 0, 0, 0, time.Local)},
+	} {
+		got, err := parseDateTime(test.args, now)
+		if err != nil || !got.Equal(test.expected) {
+			t.Errorf("Got %v (%v) for %q, wanted %v", got, err, test.args, test.expected)
+		}
+	}
+	for _, args := range [][]string{
+		{"20240115"},
+		{"2024015", "000000"},
+		{"20240115", "0000"},
+		{"+10115", "000000"},
+		{"20241315", "000000"},
+		{"20240115", "000000", "UTC"},
+	} {
+		if _, err := parseDateTime(args, now); err != ErrSyntax {
+			t.Errorf("Got %v for %q, wanted a syntax error", err, args)
+		}
+	}
+}
+
+func TestNewNews(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	if hasLine(capabilities(t, c), "NEWNEWS") {
+		t.Fatalf("NEWNEWS advertised without BackendNewNews")
+	}
+	cmd(t, c, 502, "NEWNEWS misc.* 20240110 000000 GMT")
+}
+
+// indexBackend answers NEWNEWS itself.
+type indexBackend struct {
+	*testBackend
+	wildmat string
+	since   time.Time
+}
+
+func (ib *indexBackend) NewNews(ctx context.Context, session map[string]string, wildmat *nntp.Wildmat, since time.Time) ([]string, error) {
+	ib.wildmat, ib.since = wildmat.String(), since
+	return []string{"<a@example.com>", "<b@example.com>"}, nil
+}
+
+func TestNewNewsBackend(t *testing.T) {
+	ib := &indexBackend{testBackend: newTestBackend()}
+	s := NewServer(ib, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	if !hasLine(capabilities(t, c), "NEWNEWS") {
+		t.Fatalf("NEWNEWS not advertised")
+	}
+	cmd(t, c, 230, "NEWNEWS *,!alt.* 240110 123000 GMT")
+	lines, err := c.ReadDotLines()
+	if err != nil || strings.Join(lines, " ") != "<a@example.com> <b@example.com>" {
+		t.Fatalf("Got %q (%v)", lines, err)
+	}
+	if ib.wildmat != "*,!alt.*" || !ib.since.Equal(time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("Backend got %q, %v", ib.wildmat, ib.since)
+	}
+	cmd(t, c, 501, "NEWNEWS misc.* 20240110")
+}
+
+// groupsBackend has a group created on 2024-01-15.
+type groupsBackend struct {
+	*testBackend
+}
+
+func (gb *groupsBackend) NewGroups(ctx context.Context, session map[string]string, since time.Time) ([]*nntp.Group, error) {
+	if since.After(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		return nil, nil
+	}
+	return []*nntp.Group{gb.groups["misc.test"]}, nil
+}
+
+func TestNewGroups(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 231, "NEWGROUPS 20240101 000000 GMT")
+	if lines, err := c.ReadDotLines(); err != nil || len(lines) != 0 {
+		t.Fatalf("Got %q (%v) without BackendNewGroups", lines, err)
+	}
+
+	s = NewServer(&groupsBackend{newTestBackend()}, testIDGen{})
+	c, _ = newTestConn(t, s)
+	for _, test := range []struct {
+		args     string
+		expected string
+	}{
+		{"20240101 000000 GMT", "misc.test 4 1 y"},
+		{"240101 000000 GMT", "misc.test 4 1 y"},
+		{"240201 000000 GMT", ""},
+	} {
+		cmd(t, c, 231, "NEWGROUPS %s", test.args)
+		lines, err := c.ReadDotLines()
+		if err != nil || strings.Join(lines, "|") != test.expected {
+			t.Errorf("Got %q (%v) for %s, wanted %q", lines, err, test.args, test.expected)
+		}
+	}
+	cmd(t, c, 501, "NEWGROUPS 2024 000000")
+}
+
+func TestDate(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.Now = func() time.Time {
+		return time.Date(2024, 1, 15, 13, 4, 5, 0, time.FixedZone("CET", 3600))
+	}
+	c, _ := newTestConn(t, s)
+	if msg := cmd(t, c, 111, "DATE"); msg != "20240115120405" {
+		t.Fatalf("Got %q", msg)
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	// Not required: the backend refuses posting.
+	cmd(t, c, 440, "POST")
+
+	s.RequireTLSForPost = true
+	cmd(t, c, 483, "POST")
+	cmd(t, c, 483, "IHAVE <a@example.com>")
+	cmd(t, c, 483, "CHECK <a@example.com>")
+
+	s.RequireTLSForAuth = true
+	cmd(t, c, 483, "AUTHINFO USER fred")
+	s.RequireTLSForAuth = false
+	cmd(t, c, 381, "AUTHINFO USER fred")
+}
+
+func TestHelp(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.HelpText = "Posting rules: be nice.\n.Contact: news@example.com\n"
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 100, "HELP")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatalf("Error reading help: %v", err)
+	}
+	if !hasLine(lines, "  GROUP") || !hasLine(lines, "  HELP") {
+		t.Fatalf("Commands missing from help: %q", lines)
+	}
+	n := len(lines)
+	if n < 2 || lines[n-2] != "Posting rules: be nice." || lines[n-1] != ".Contact: news@example.com" {
+		t.Fatalf("Help text not appended: %q", lines)
+	}
+}
+
+// rangeBackend records the ranges asked for.
+type rangeBackend struct {
+	*testBackend
+	ranges [][2]int64
+}
+
+func (rb *rangeBackend) GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	rb.ranges = append(rb.ranges, [2]int64{from, to})
+	ch := make(chan NumberedArticle, to-from+1)
+	for n := from; n <= to; n++ {
+		ch <- NumberedArticle{n, &nntp.Article{}}
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestListWildmat(t *testing.T) {
+	tb := newTestBackend()
+	tb.groups["misc.other"] = &nntp.Group{Name: "misc.other", Low: 1, High: 0}
+	tb.groups["alt.test"] = &nntp.Group{Name: "alt.test", Low: 1, High: 0}
+	s := NewServer(tb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	for _, test := range []struct {
+		wildmat  string
+		expected []string
+	}{
+		{"misc.*", []string{"misc.other", "misc.test"}},
+		// The rightmost matching pattern decides, as for NEWNEWS.
+		{"misc.*,!alt.*,alt.test,!misc.test", []string{"alt.test", "misc.other"}},
+		{"*,!misc.*", []string{"alt.test"}},
+	} {
+		cmd(t, c, 215, "LIST ACTIVE %s", test.wildmat)
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatalf("Error reading groups: %v", err)
+		}
+		var names []string
+		for _, line := range lines {
+			names = append(names, strings.Fields(line)[0])
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(test.expected) {
+			t.Errorf("LIST ACTIVE %s gave %v, wanted %v", test.wildmat, names, test.expected)
+		}
+	}
+	cmd(t, c, 501, "LIST ACTIVE misc.[ab]")
+}
+
+func TestListgroupRange(t *testing.T) {
+	rb := &rangeBackend{testBackend: newTestBackend()}
+	s := NewServer(rb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	for _, test := range []struct {
+		arg      string
+		expected string
+	}{
+		{"1-999999999", "1 2 3 4"},
+		{"3-", "3 4"},
+		{"", "1 2 3 4"},
+		{"10-20", ""},
+	} {
+		cmd(t, c, 211, "LISTGROUP misc.test %s", test.arg)
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatalf("Error reading article numbers: %v", err)
+		}
+		// An empty list has no lines, not an empty one.
+		got := strings.Join(lines, " ")
+		if got != test.expected || len(lines) != len(strings.Fields(test.expected)) {
+			t.Errorf("LISTGROUP %s gave %q, wanted %q", test.arg, lines, test.expected)
+		}
+	}
+	expected := [][2]int64{{1, 4}, {3, 4}, {1, 4}}
+	if fmt.Sprint(rb.ranges) != fmt.Sprint(expected) {
+		t.Fatalf("Backend asked for %v, wanted %v", rb.ranges, expected)
+	}
+}
+
+// numbersBackend knows the numbers of its articles, of which 2 is
+// missing.
+type numbersBackend struct {
+	*testBackend
+}
+
+func (nb *numbersBackend) ArticleNumbers(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) ([]int64, error) {
+	var nums []int64
+	for _, n := range []int64{1, 3, 4} {
+		if from <= n && n <= to {
+			nums = append(nums, n)
+		}
+	}
+	return nums, nil
+}
+
+func TestListgroupSelects(t *testing.T) {
+	s := NewServer(&numbersBackend{newTestBackend()}, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 412, "LISTGROUP")
+	for _, test := range []struct {
+		cmd      string
+		expected string
+	}{
+		{"LISTGROUP misc.test 2-", "3 4"},
+		// The group is selected now.
+		{"LISTGROUP", "1 3 4"},
+	} {
+		cmd(t, c, 211, "%s", test.cmd)
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatalf("Error reading article numbers: %v", err)
+		}
+		if got := strings.Join(lines, " "); got != test.expected {
+			t.Errorf("%s gave %q, wanted %q", test.cmd, got, test.expected)
+		}
+	}
+	// The current article is the first one.
+	cmd(t, c, 223, "STAT")
+}
+
+// headerBackend answers HDR for Subject, with article 2 missing.
+type headerBackend struct {
+	*testBackend
+}
+
+func (hb *headerBackend) GetHeader(ctx context.Context, session map[string]string, group *nntp.Group, header string, from, to int64) ([]NumberedHeader, error) {
+	var headers []NumberedHeader
+	for _, n := range []int64{1, 3, 4} {
+		if from <= n && n <= to {
+			headers = append(headers, NumberedHeader{n, fmt.Sprintf("%s\tof %d", header, n)})
+		}
+	}
+	return headers, nil
+}
+
+func TestHdr(t *testing.T) {
+	s := NewServer(&headerBackend{newTestBackend()}, testIDGen{})
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+
+	for _, test := range []struct {
+		cmd      string
+		expected []string
+	}{
+		{"HDR Subject 2-", []string{"3 Subject of 3", "4 Subject of 4"}},
+		{"XHDR Subject 3", []string{"3 Subject of 3"}},
+		// The current article, set by GROUP.
+		{"HDR Subject", []string{"1 Subject of 1"}},
+		{"HDR Subject 10-20", nil},
+	} {
+		cmd(t, c, 225, "%s", test.cmd)
+		lines, err := c.ReadDotLines()
+		if err != nil || strings.Join(lines, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("Got %q (%v) for %s, wanted %q", lines, err, test.cmd, test.expected)
+		}
+	}
+	cmd(t, c, 501, "HDR")
+
+	// Without BackendHeader, the articles are retrieved.
+	s = NewServer(&rangeBackend{testBackend: newTestBackend()}, testIDGen{})
+	c, _ = newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+	cmd(t, c, 225, "HDR :lines 3-")
+	if lines, err := c.ReadDotLines(); err != nil || strings.Join(lines, "|") != "3 0|4 0" {
+		t.Errorf("Got %q (%v)", lines, err)
+	}
+}
+
+func TestReadLimitedLine(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader(
+		"GROUP misc.test\r\n"+strings.Repeat("x", 100)+"\r\n"+"12345\nDATE"), 16)
+	for _, test := range []struct {
+		line string
+		err  error
+	}{
+		{"GROUP misc.test", nil},
+		{"", ErrLineTooLong},
+		{"12345", nil},
+		{"DATE", nil},
+		{"", io.EOF},
+	} {
+		line, err := readLimitedLine(r, 20)
+		if line != test.line || err != test.err {
+			t.Fatalf("Got %q (%v), wanted %q (%v)", line, err, test.line, test.err)
+		}
+	}
+}
+
+func TestLongCommandLine(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.MaxLineLength = 64
+	c, _ := newTestConn(t, s)
+
+	cmd(t, c, 500, "GROUP %s", strings.Repeat("x", 1000))
+	cmd(t, c, 211, "GROUP misc.test")
+}
+
+// postBackend accepts posts, except to acl.test.
+type postBackend struct {
+	*testBackend
+	posted []string
+	bodies []string
+}
+
+func newPostBackend() *postBackend {
+	tb := newTestBackend()
+	for name, status := range map[string]nntp.PostingStatus{
+		"mod.test": nntp.PostingModerated,
+		"ro.test":  nntp.PostingNotPermitted,
+		"acl.test": nntp.PostingPermitted,
+	} {
+		tb.groups[name] = &nntp.Group{Name: name, Posting: status}
+	}
+	return &postBackend{testBackend: tb}
+}
+
+func (pb *postBackend) AllowPost(ctx context.Context, session map[string]string) bool {
+	return true
+}
+
+func (pb *postBackend) Post(ctx context.Context, session map[string]string, article *nntp.Article) error {
+	body, err := io.ReadAll(article.Body)
+	if err != nil {
+		return err
+	}
+	pb.posted = append(pb.posted, article.Header.Get("Subject"))
+	pb.bodies = append(pb.bodies, string(body))
+	return nil
+}
+
+func (pb *postBackend) AllowPostGroup(ctx context.Context, session map[string]string, group *nntp.Group) bool {
+	return group.Name != "acl.test"
+}
+
+// post posts an article from fred with the given extra header lines.
+func post(t *testing.T, c *textproto.Conn, code int, headers ...string) string {
+	t.Helper()
+	cmd(t, c, 340, "POST")
+	c.PrintfLine("From: fred@example.com")
+	for _, h := range headers {
+		c.PrintfLine("%s", h)
+	}
+	c.PrintfLine("")
+	c.PrintfLine("body")
+	c.PrintfLine(".")
+	_, msg, err := c.ReadCodeLine(code)
+	if err != nil {
+		t.Fatalf("Unexpected response to post: %v", err)
+	}
+	return msg
+}
+
+func TestPostCrosspost(t *testing.T) {
+	pb := newPostBackend()
+	s := NewServer(pb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	post(t, c, 240, "Subject: one", "Newsgroups: misc.test")
+	for _, test := range []struct {
+		newsgroups string
+		group      string
+	}{
+		{"misc.test, ro.test", "ro.test"},
+		{"misc.test,no.such.group", "no.such.group"},
+		{"acl.test,misc.test", "acl.test"},
+	} {
+		msg := post(t, c, 441, "Subject: rejected", "Newsgroups: "+test.newsgroups)
+		if !strings.Contains(msg, test.group) {
+			t.Errorf("Rejection of %s doesn't name %s: %q", test.newsgroups, test.group, msg)
+		}
+	}
+	// Left to the backend to forward to the moderator.
+	post(t, c, 240, "Subject: two", "Newsgroups: misc.test,mod.test")
+	post(t, c, 240, "Subject: three", "Newsgroups: misc.test,mod.test", "Approved: mod@example.com")
+	if strings.Join(pb.posted, " ") != "one two three" {
+		t.Fatalf("Backend got %q", pb.posted)
+	}
+}
+
+func TestRequiredHeaders(t *testing.T) {
+	pb := newPostBackend()
+	s := NewServer(pb, testIDGen{})
+	c, _ := newTestConn(t, s)
+
+	msg := post(t, c, 441, "Newsgroups: misc.test")
+	if !strings.Contains(msg, "Subject") {
+		t.Errorf("Rejection doesn't name the Subject header: %q", msg)
+	}
+	post(t, c, 441, "Subject: blank", "Newsgroups: ")
+
+	cmd(t, c, 335, "IHAVE <new@example.com>")
+	c.PrintfLine("Newsgroups: misc.test")
+	c.PrintfLine("")
+	c.PrintfLine("body")
+	c.PrintfLine(".")
+	if _, _, err := c.ReadCodeLine(437); err != nil {
+		t.Fatalf("Unexpected response to IHAVE: %v", err)
+	}
+
+	s.RequiredHeaders = []string{"Organization"}
+	post(t, c, 441, "Subject: one", "Newsgroups: misc.test")
+	post(t, c, 240, "Subject: one", "Newsgroups: misc.test", "Organization: Slate Rock")
+	s.RequiredHeaders = []string{}
+	post(t, c, 240, "Newsgroups: misc.test")
+	if len(pb.posted) != 2 {
+		t.Fatalf("Backend got %q", pb.posted)
+	}
+}
+
+func TestQuitDuringPost(t *testing.T) {
+	pb := newPostBackend()
+	s := NewServer(pb, testIDGen{})
+
+	// A QUIT line within the article is part of it.
+	c, _ := newTestConn(t, s)
+	post(t, c, 240, "Subject: one", "Newsgroups: misc.test")
+	cmd(t, c, 340, "POST")
+	for _, line := range []string{"From: fred@example.com", "Subject: two",
+		"Newsgroups: misc.test", "", "QUIT", "."} {
+		c.PrintfLine("%s", line)
+	}
+	if _, _, err := c.ReadCodeLine(240); err != nil {
+		t.Fatalf("Unexpected response to post: %v", err)
+	}
+	cmd(t, c, 205, "QUIT")
+	if pb.bodies[1] != "QUIT\n" {
+		t.Fatalf("Backend got body %q", pb.bodies[1])
+	}
+
+	// Hanging up before the end of the article discards it, without a
+	// response. A half-closed connection shows what the server sends.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sconn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.Process(sconn, nil)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c = textproto.NewConn(conn)
+	if _, _, err := c.ReadCodeLine(200); err != nil {
+		t.Fatalf("Error reading banner: %v", err)
+	}
+	cmd(t, c, 340, "POST")
+	for _, line := range []string{"From: fred@example.com", "Subject: three",
+		"Newsgroups: misc.test", "", "partial", "QUIT"} {
+		c.PrintfLine("%s", line)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	if line, err := c.ReadLine(); err != io.EOF {
+		t.Fatalf("Got %q (%v) after hanging up, wanted EOF", line, err)
+	}
+	<-done
+	if len(pb.posted) != 2 {
+		t.Fatalf("Backend got %q", pb.posted)
+	}
+}
+
+// identityBackend records the identity seen by GetGroup.
+type identityBackend struct {
+	*testBackend
+	identity string
+}
+
+func (ib *identityBackend) GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error) {
+	ib.identity = IdentityFromContext(ctx)
+	return ib.testBackend.GetGroup(ctx, session, name)
+}
+
+func TestIdentityInContext(t *testing.T) {
+	ib := &identityBackend{testBackend: newTestBackend()}
+	s := NewServer(ib, testIDGen{})
+	c, cs := newTestConn(t, s)
+
+	cmd(t, c, 211, "GROUP misc.test")
+	if ib.identity != "" {
+		t.Fatalf("Got identity %q before authentication", ib.identity)
+	}
+	cmd(t, c, 381, "AUTHINFO USER fred")
+	cmd(t, c, 281, "AUTHINFO PASS flintstone")
+	cmd(t, c, 211, "GROUP misc.test")
+	if ib.identity != "fred" || cs[IdentityKey] != "fred" {
+		t.Fatalf("Got identity %q (session %q), wanted fred", ib.identity, cs[IdentityKey])
+	}
+}
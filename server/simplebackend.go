@@ -0,0 +1,175 @@
+/*
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2015 Simon Schmidt
+ * Copyright (c) 2012-2014  Dustin Sallings <dustin@spy.net>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ * <http://www.opensource.org/licenses/mit-license.php>
+ *
+ *
+ * RFC Snippets inside some comments: Copyright (C) The Internet Society (2006).
+ */
+
+package nntpserver
+
+import (
+	"context"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// SimpleBackend is the context-free form of Backend.
+//
+// Existing backends written against it can be used with the server by
+// wrapping them with AdaptBackend. A backend returned from Authenticate
+// must be a (possibly adapted) Backend.
+type SimpleBackend interface {
+	ListGroups(session map[string]string) (<-chan *nntp.Group, error)
+	GetGroup(session map[string]string, name string) (*nntp.Group, error)
+	GetArticleWithNoGroup(session map[string]string, id string) (*nntp.Article, error)
+	GetArticle(session map[string]string, group *nntp.Group, id string) (*nntp.Article, error)
+	GetArticles(session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error)
+	Authorized(session map[string]string) bool
+	Authenticate(session map[string]string, user, pass string) (Backend, error)
+	AllowPost(session map[string]string) bool
+	Post(session map[string]string, article *nntp.Article) error
+}
+
+// SimpleBackendIHave is the context-free form of BackendIHave.
+type SimpleBackendIHave interface {
+	IHave(session map[string]string, id string, article *nntp.Article) error
+	IHaveWantArticle(session map[string]string, id string) error
+}
+
+// SimpleBackendListWildMat is the context-free form of BackendListWildMat.
+type SimpleBackendListWildMat interface {
+	ListGroupsWildMat(session map[string]string, pattern *WildMat) (<-chan *nntp.Group, error)
+}
+
+// AdaptBackend wraps a SimpleBackend into a Backend, ignoring the
+// contexts passed in by the server.
+//
+// The optional interfaces are still detected on the wrapped backend, in
+// either their context-free (SimpleBackendIHave, SimpleBackendListWildMat)
+// or their regular form.
+func AdaptBackend(b SimpleBackend) Backend {
+	return &simpleBackendAdapter{b}
+}
+
+type simpleBackendAdapter struct {
+	b SimpleBackend
+}
+
+// setOptional sets the optional interfaces of s from the wrapped backend.
+func (a *simpleBackendAdapter) setOptional(s *session) {
+	switch b := a.b.(type) {
+	case BackendIHave:
+		s.beIhave = b
+	case SimpleBackendIHave:
+		s.beIhave = simpleIHaveAdapter{b}
+	}
+	switch b := a.b.(type) {
+	case BackendListWildMat:
+		s.beWildMat = b
+	case SimpleBackendListWildMat:
+		s.beWildMat = simpleListWildMatAdapter{b}
+	}
+	if b, ok := a.b.(BackendGroupEstimate); ok {
+		s.beEstimate = b
+	}
+	if b, ok := a.b.(BackendPostGroup); ok {
+		s.bePostGroup = b
+	}
+	if b, ok := a.b.(BackendOverviewSchema); ok {
+		s.beOverview = b
+	}
+	if b, ok := a.b.(BackendOverview); ok {
+		s.beOver = b
+	}
+	if b, ok := a.b.(BackendArticleNumbers); ok {
+		s.beNumbers = b
+	}
+	if b, ok := a.b.(BackendHeader); ok {
+		s.beHeader = b
+	}
+	if b, ok := a.b.(BackendNewNews); ok {
+		s.beNewNews = b
+	}
+	if b, ok := a.b.(BackendNewGroups); ok {
+		s.beNewGroups = b
+	}
+}
+
+func (a *simpleBackendAdapter) ListGroups(ctx context.Context, session map[string]string) (<-chan *nntp.Group, error) {
+	return a.b.ListGroups(session)
+}
+
+func (a *simpleBackendAdapter) GetGroup(ctx context.Context, session map[string]string, name string) (*nntp.Group, error) {
+	return a.b.GetGroup(session, name)
+}
+
+func (a *simpleBackendAdapter) GetArticleWithNoGroup(ctx context.Context, session map[string]string, id string) (*nntp.Article, error) {
+	return a.b.GetArticleWithNoGroup(session, id)
+}
+
+func (a *simpleBackendAdapter) GetArticle(ctx context.Context, session map[string]string, group *nntp.Group, id string) (*nntp.Article, error) {
+	return a.b.GetArticle(session, group, id)
+}
+
+func (a *simpleBackendAdapter) GetArticles(ctx context.Context, session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	return a.b.GetArticles(session, group, from, to)
+}
+
+func (a *simpleBackendAdapter) Authorized(ctx context.Context, session map[string]string) bool {
+	return a.b.Authorized(session)
+}
+
+func (a *simpleBackendAdapter) Authenticate(ctx context.Context, session map[string]string, user, pass string) (Backend, error) {
+	return a.b.Authenticate(session, user, pass)
+}
+
+func (a *simpleBackendAdapter) AllowPost(ctx context.Context, session map[string]string) bool {
+	return a.b.AllowPost(session)
+}
+
+func (a *simpleBackendAdapter) Post(ctx context.Context, session map[string]string, article *nntp.Article) error {
+	return a.b.Post(session, article)
+}
+
+type simpleIHaveAdapter struct {
+	b SimpleBackendIHave
+}
+
+func (a simpleIHaveAdapter) IHave(ctx context.Context, session map[string]string, id string, article *nntp.Article) error {
+	return a.b.IHave(session, id, article)
+}
+
+func (a simpleIHaveAdapter) IHaveWantArticle(ctx context.Context, session map[string]string, id string) error {
+	return a.b.IHaveWantArticle(session, id)
+}
+
+type simpleListWildMatAdapter struct {
+	b SimpleBackendListWildMat
+}
+
+func (a simpleListWildMatAdapter) ListGroupsWildMat(ctx context.Context, session map[string]string, pattern *WildMat) (<-chan *nntp.Group, error) {
+	return a.b.ListGroupsWildMat(session, pattern)
+}
@@ -0,0 +1,94 @@
+package nntpserver
+
+import (
+	"testing"
+
+	"github.com/kothawoc/go-nntp"
+)
+
+// legacyBackend is a context-free backend with the optional IHAVE and
+// wildmat interfaces.
+type legacyBackend struct {
+	wildmats int
+}
+
+func (lb *legacyBackend) ListGroups(session map[string]string) (<-chan *nntp.Group, error) {
+	return nil, ErrNoSuchGroup
+}
+
+func (lb *legacyBackend) ListGroupsWildMat(session map[string]string, pattern *WildMat) (<-chan *nntp.Group, error) {
+	lb.wildmats++
+	ch := make(chan *nntp.Group, 1)
+	ch <- &nntp.Group{Name: "misc.test", Low: 1, High: 4, Posting: nntp.PostingNotPermitted}
+	close(ch)
+	return ch, nil
+}
+
+func (lb *legacyBackend) GetGroup(session map[string]string, name string) (*nntp.Group, error) {
+	if name != "misc.test" {
+		return nil, ErrNoSuchGroup
+	}
+	return &nntp.Group{Name: name, Count: 3, Low: 1, High: 4}, nil
+}
+
+func (lb *legacyBackend) GetArticleWithNoGroup(session map[string]string, id string) (*nntp.Article, error) {
+	return nil, ErrInvalidMessageID
+}
+
+func (lb *legacyBackend) GetArticle(session map[string]string, group *nntp.Group, id string) (*nntp.Article, error) {
+	return nil, ErrInvalidArticleNumber
+}
+
+func (lb *legacyBackend) GetArticles(session map[string]string, group *nntp.Group, from, to int64) (<-chan NumberedArticle, error) {
+	return nil, ErrInvalidArticleNumber
+}
+
+func (lb *legacyBackend) Authorized(session map[string]string) bool {
+	return true
+}
+
+func (lb *legacyBackend) Authenticate(session map[string]string, user, pass string) (Backend, error) {
+	return nil, ErrAuthRejected
+}
+
+func (lb *legacyBackend) AllowPost(session map[string]string) bool {
+	return false
+}
+
+func (lb *legacyBackend) Post(session map[string]string, article *nntp.Article) error {
+	return ErrPostingFailed
+}
+
+func (lb *legacyBackend) IHave(session map[string]string, id string, article *nntp.Article) error {
+	return ErrIHaveRejected
+}
+
+func (lb *legacyBackend) IHaveWantArticle(session map[string]string, id string) error {
+	return ErrNotWanted
+}
+
+func TestAdaptBackend(t *testing.T) {
+	lb := &legacyBackend{}
+	s := NewServer(AdaptBackend(lb), testIDGen{})
+
+	sess := &session{server: s}
+	sess.setBackend(s.Backend)
+	if sess.beIhave == nil || sess.beWildMat == nil {
+		t.Fatalf("Optional interfaces of the wrapped backend not found")
+	}
+	if sess.beEstimate != nil {
+		t.Fatalf("Found an unimplemented optional interface")
+	}
+
+	c, _ := newTestConn(t, s)
+	cmd(t, c, 211, "GROUP misc.test")
+	cmd(t, c, 215, "LIST ACTIVE misc.*")
+	if _, err := c.ReadDotLines(); err != nil {
+		t.Fatalf("Error reading list: %v", err)
+	}
+	if lb.wildmats != 1 {
+		t.Fatalf("ListGroupsWildMat called %d times, wanted 1", lb.wildmats)
+	}
+	// IHaveWantArticle says no, while the fallback would have accepted.
+	cmd(t, c, 435, "IHAVE <a@example.com>")
+}
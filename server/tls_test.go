@@ -0,0 +1,164 @@
+package nntpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kothawoc/go-nntp/internal/testcert"
+)
+
+func TestStartTLSCapabilities(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testcert.New(t)}}
+	s.SASL = &BuiltinSASL{}
+	s.RequireTLSForAuth = true
+
+	// TLS needs a real connection.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		sconn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.Process(sconn, nil)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c := textproto.NewConn(conn)
+	if _, _, err := c.ReadCodeLine(200); err != nil {
+		t.Fatalf("Error reading banner: %v", err)
+	}
+
+	before := capabilities(t, c)
+	if !hasLine(before, "STARTTLS") || hasLine(before, "AUTHINFO SASL") {
+		t.Fatalf("Unexpected capabilities before STARTTLS: %q", before)
+	}
+	cmd(t, c, 382, "STARTTLS")
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("Error negotiating TLS: %v", err)
+	}
+	c = textproto.NewConn(tlsConn)
+
+	after := capabilities(t, c)
+	if hasLine(after, "STARTTLS") || !hasLine(after, "AUTHINFO SASL") {
+		t.Fatalf("Unexpected capabilities after STARTTLS: %q", after)
+	}
+	cmd(t, c, 502, "STARTTLS")
+}
+
+func TestStartTLS(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	cconn, sconn := net.Pipe()
+	defer cconn.Close()
+	go s.Process(sconn, nil)
+	c := textproto.NewConn(cconn)
+	if _, _, err := c.ReadCodeLine(200); err != nil {
+		t.Fatalf("Error reading banner: %v", err)
+	}
+	cmd(t, c, 502, "STARTTLS")
+
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testcert.New(t)}}
+	// Pipelined commands are refused, and then run unprotected.
+	c.W.WriteString("STARTTLS\r\nDATE\r\n")
+	c.W.Flush()
+	if _, _, err := c.ReadCodeLine(580); err != nil {
+		t.Fatalf("Pipelined STARTTLS: %v", err)
+	}
+	if _, _, err := c.ReadCodeLine(111); err != nil {
+		t.Fatalf("Command after STARTTLS: %v", err)
+	}
+
+	cmd(t, c, 211, "GROUP misc.test")
+	cmd(t, c, 382, "STARTTLS")
+	tlsConn := tls.Client(cconn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("Error negotiating TLS: %v", err)
+	}
+	c = textproto.NewConn(tlsConn)
+	// The session starts over.
+	cmd(t, c, 412, "STAT")
+	cmd(t, c, 502, "STARTTLS")
+}
+
+func TestServeTLS(t *testing.T) {
+	s := NewServer(newTestBackend(), testIDGen{})
+	if err := s.ListenAndServeTLS("127.0.0.1:0", nil); err == nil {
+		t.Fatalf("Served TLS without a config")
+	}
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testcert.New(t)}}
+	s.TLSHandshakeTimeout = 50 * time.Millisecond
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(tls.NewListener(l, s.TLSConfig))
+	}()
+
+	// A client failing the negotiation is dropped.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	conn.Write([]byte("CAPABILITIES\r\n"))
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// The server sends a TLS alert at most.
+	if _, err := io.Copy(io.Discard, conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Connection not dropped")
+	}
+	conn.Close()
+
+	// So does a client stalling the negotiation.
+	conn, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Stalled connection not dropped")
+	}
+	conn.Close()
+
+	for i := 0; i < 2; i++ {
+		tlsConn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("Error connecting with TLS: %v", err)
+		}
+		tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+		c := textproto.NewConn(tlsConn)
+		if _, _, err := c.ReadCodeLine(200); err != nil {
+			t.Fatalf("Error reading banner: %v", err)
+		}
+		if caps := capabilities(t, c); hasLine(caps, "STARTTLS") {
+			t.Fatalf("STARTTLS offered over TLS: %q", caps)
+		}
+		cmd(t, c, 502, "STARTTLS")
+		c.Close()
+	}
+
+	l.Close()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatalf("Serve returned no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve didn't return after closing the listener")
+	}
+}
@@ -1,9 +1,12 @@
 package nntpserver
 
 import (
+	"bufio"
+	"io"
 	"net/textproto"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var headerCorrection = map[string]string{
@@ -87,3 +90,115 @@ func GetGroups(t textproto.MIMEHeader) (r []string) {
 	}
 	return r
 }
+
+// readLimitedLine reads a line like textproto.Reader.ReadLine, but
+// without buffering more than max bytes of it. Longer lines are
+// consumed and reported with ErrLineTooLong.
+func readLimitedLine(r *bufio.Reader, max int) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+2 {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) > 0 && !tooLong:
+			// An unterminated last line.
+		case err != nil:
+			return "", err
+		}
+		break
+	}
+	s := string(line)
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	if tooLong || len(s) > max {
+		return "", ErrLineTooLong
+	}
+	return s, nil
+}
+
+// An articleBody reads an article sent by the client, noting whether
+// the connection ended before the terminating line.
+type articleBody struct {
+	r   io.Reader
+	err error
+}
+
+func newArticleBody(c *textproto.Conn) *articleBody {
+	return &articleBody{r: c.DotReader()}
+}
+
+func (b *articleBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// finish reads the rest of the article and returns err, or io.EOF (which
+// ends the session) if the article was cut short.
+func (b *articleBody) finish(err error) error {
+	io.Copy(io.Discard, b)
+	if b.err != nil {
+		return io.EOF
+	}
+	return err
+}
+
+// hungUp tells whether a read error means the client has hung up.
+func hungUp(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// parseDateTime parses the date, time and optional "GMT" arguments of
+// NEWGROUPS and NEWNEWS. The date is in yyyymmdd or yymmdd form; a
+// two-digit year is taken from the century of now if that doesn't make
+// it later than the current year, and from the previous century
+// otherwise (RFC 3977, section 7.3.2). Without "GMT", the time is the
+// server's local time.
+func parseDateTime(args []string, now time.Time) (time.Time, error) {
+	if len(args) < 2 || len(args) > 3 ||
+		(len(args) == 3 && !strings.EqualFold(args[2], "GMT")) {
+		return time.Time{}, ErrSyntax
+	}
+	date, clock := args[0], args[1]
+	for _, r := range date + clock {
+		if r < '0' || r > '9' {
+			return time.Time{}, ErrSyntax
+		}
+	}
+	loc := time.Local
+	if len(args) == 3 {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+	if len(date) == 6 {
+		yy, err := strconv.Atoi(date[:2])
+		if err != nil {
+			return time.Time{}, ErrSyntax
+		}
+		century := now.Year() / 100 * 100
+		if century+yy > now.Year() {
+			century -= 100
+		}
+		date = strconv.Itoa(century+yy) + date[2:]
+	}
+	if len(date) != 8 || len(clock) != 6 {
+		return time.Time{}, ErrSyntax
+	}
+	t, err := time.ParseInLocation("20060102150405", date+clock, loc)
+	if err != nil {
+		return time.Time{}, ErrSyntax
+	}
+	return t, nil
+}
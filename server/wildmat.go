@@ -32,20 +32,34 @@ import (
 	"strings"
 	"regexp"
 	"bytes"
+
+	"github.com/kothawoc/go-nntp"
 )
 
 var wildMatParse = regexp.MustCompile(`\*|\?|[^\*\?]+`)
 
+// A WildMat is the wildmat argument of LIST. The rule sets are kept for
+// backends implementing BackendListWildMat, but a WildMat made by
+// ParseWildMat matches like nntp.Wildmat (the rightmost matching pattern
+// decides), as for NEWNEWS.
 type WildMat struct{
 	RuleSets []*WildMatRuleSet
+	wildmat *nntp.Wildmat
+	err error
 }
 func (wmrs *WildMat) Match(s string) bool {
+	if wmrs.wildmat != nil {
+		return wmrs.wildmat.Match(s)
+	}
 	for _,rs := range wmrs.RuleSets {
 		if rs.Match(s) { return true }
 	}
 	return false
 }
+// Compile fails for wildmats nntp.NewWildmat rejects, then compiles
+// the rule sets.
 func (wmrs *WildMat) Compile() error {
+	if wmrs.err != nil { return wmrs.err }
 	for _,rs := range wmrs.RuleSets {
 		e := rs.Compile()
 		if e!=nil { return e }
@@ -130,6 +144,7 @@ func ParseWildMat(wm string) *WildMat{
 			wmr.Positive = append(wmr.Positive,elem)
 		}
 	}
-	return &WildMat{wmra}
+	w,err := nntp.NewWildmat(wm)
+	return &WildMat{RuleSets: wmra, wildmat: w, err: err}
 }
 
@@ -0,0 +1,106 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Wildmat is a wildmat as defined by RFC 3977, section 4: a list of
+// comma-separated patterns, each of which may be negated with a leading
+// "!". In patterns, "*" matches any sequence of characters and "?" any
+// single character.
+type Wildmat struct {
+	patterns []wildmatPattern
+}
+
+type wildmatPattern struct {
+	negated bool
+	pattern string
+}
+
+// NewWildmat parses a wildmat.
+func NewWildmat(pattern string) (*Wildmat, error) {
+	w := &Wildmat{}
+	for _, p := range strings.Split(pattern, ",") {
+		wp := wildmatPattern{pattern: p}
+		if strings.HasPrefix(p, "!") {
+			wp = wildmatPattern{negated: true, pattern: p[1:]}
+		}
+		if wp.pattern == "" {
+			return nil, fmt.Errorf("invalid wildmat %q: empty pattern", pattern)
+		}
+		if i := strings.IndexAny(wp.pattern, "![\\]"); i >= 0 {
+			return nil, fmt.Errorf("invalid wildmat %q: unexpected %q", pattern, wp.pattern[i])
+		}
+		if !utf8.ValidString(wp.pattern) {
+			return nil, fmt.Errorf("invalid wildmat %q: not UTF-8", pattern)
+		}
+		w.patterns = append(w.patterns, wp)
+	}
+	return w, nil
+}
+
+// Match reports whether name matches the wildmat. The patterns are
+// tried from right to left, and the first one to match decides: name
+// matches unless that pattern is negated. A name that no pattern
+// matches doesn't match.
+func (w *Wildmat) Match(name string) bool {
+	for i := len(w.patterns) - 1; i >= 0; i-- {
+		if p := w.patterns[i]; globMatch(p.pattern, name) {
+			return !p.negated
+		}
+	}
+	return false
+}
+
+// String returns the wildmat as parsed.
+func (w *Wildmat) String() string {
+	parts := make([]string, len(w.patterns))
+	for i, p := range w.patterns {
+		parts[i] = p.pattern
+		if p.negated {
+			parts[i] = "!" + p.pattern
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// globMatch reports whether name matches a single wildmat pattern.
+func globMatch(pattern, name string) bool {
+	// The positions to go back to after a mismatch: just after the last
+	// "*", and the part of name it matches extended by one character.
+	starPattern, starName := -1, 0
+	p, n := 0, 0
+	for n < len(name) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starPattern, starName = p+1, n
+				p++
+				continue
+			case '?':
+				_, size := utf8.DecodeRuneInString(name[n:])
+				p++
+				n += size
+				continue
+			default:
+				if pattern[p] == name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+		if starPattern < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(name[starName:])
+		starName += size
+		p, n = starPattern, starName
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
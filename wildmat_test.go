@@ -0,0 +1,52 @@
+package nntp
+
+import "testing"
+
+func TestWildmat(t *testing.T) {
+	tests := []struct {
+		wildmat string
+		name    string
+		match   bool
+	}{
+		{"misc.test", "misc.test", true},
+		{"misc.test", "misc.tests", false},
+		{"misc.*", "misc.test", true},
+		{"misc.*", "misc", false},
+		{"*", "", true},
+		{"misc.t?st", "misc.test", true},
+		{"misc.t?st", "misc.tst", false},
+		{"?", "é", true},
+		{"a*b*c", "axxbyybc", true},
+		{"a*b*c", "axxbyybcd", false},
+		{"comp.*,misc.*", "misc.test", true},
+		// The rightmost matching pattern decides.
+		{"*,!misc.*", "misc.test", false},
+		{"*,!misc.*", "comp.lang.go", true},
+		{"!misc.*,*", "misc.test", true},
+		{"*,!misc.*,misc.test", "misc.test", true},
+		{"*,!misc.*,misc.test", "misc.misc", false},
+		// Nothing matches.
+		{"!misc.*", "comp.lang.go", false},
+		{"!misc.*", "misc.test", false},
+	}
+	for _, test := range tests {
+		w, err := NewWildmat(test.wildmat)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", test.wildmat, err)
+		}
+		if got := w.Match(test.name); got != test.match {
+			t.Errorf("%q matching %q: got %v, wanted %v", test.wildmat, test.name, got, test.match)
+		}
+		if w.String() != test.wildmat {
+			t.Errorf("Got %q, wanted %q", w.String(), test.wildmat)
+		}
+	}
+}
+
+func TestWildmatInvalid(t *testing.T) {
+	for _, wildmat := range []string{"", "misc.*,", "!", "misc.[ab]", "a!b", `a\b`} {
+		if _, err := NewWildmat(wildmat); err == nil {
+			t.Errorf("Accepted %q", wildmat)
+		}
+	}
+}